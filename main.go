@@ -18,19 +18,31 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
+	"iter"
 	"log"
 	"math"
+	"math/big"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 )
 
@@ -39,18 +51,53 @@ var tmpl string
 
 // Result represents a palindromic fuel cost finding
 type Result struct {
-	Litres             float64
-	CostPounds         string
+	Litres             float64 // volume in Unit, litres unless stated
+	CostPounds         string  // total on the receipt, after any discount
 	LitresIsPalindrome bool
 	Type               string
+	MinLitres          float64 // metered volume at which the pump starts showing its total
+	MaxLitres          float64 // metered volume at which it moves past that total
+	WindowMl           float64 // width of that stop window in millilitres, or watt-hours for energy
+	Pattern            string  // name of the NumberPattern the cost matched, "" if only the volume did
+	Currency           string  // ISO code of the currency CostPounds is written in
+	Unit               string  // code of the VolumeUnit the volumes are in
+	Volume             string  // volume as the pump displays it, like 12.321
+	Price              Price   // price per unit exactly as searched
+	Base               int     // base the cost was a palindrome in, if not ten
+	Representation     string  // cost in minor units written in Base
+	Score              float64 // how satisfying the fill is, from the search's ScoreModel
+	PriceIsPalindrome  bool    // the price per unit reads the same backwards, like 133.1p
+	TankLevel          float64 // fuel in the tank after the fill, if the search has a Tank
+	TankFull           float64 // TankLevel as a fraction of the tank's capacity, if known
+	PumpPounds         string  // total the pump displays, if the search has a Discount or Extras
+	DiscountPounds     string  // how much the Discount takes off PumpPounds, if there is one
+	ExtrasPounds       string  // shop items added to the fuel on the receipt, if any
+	FeesPounds         string  // charging fees added to the energy on the receipt, if any
+	PumpMatches        bool    // PumpPounds matches the pattern too, not just CostPounds
+	NetPounds          string  // CostPounds less VAT, if the search has a VAT rate
+	VATPounds          string  // VAT included in CostPounds, if the search has a VAT rate
+	NetMatches         bool    // NetPounds matches the pattern too
+	VATMatches         bool    // VATPounds matches the pattern too
+}
+
+// IsTriplePalindrome reports whether the whole receipt reads the same
+// backwards: the price per unit, the litres and the palindromic cost
+func (r Result) IsTriplePalindrome() bool {
+	return r.PriceIsPalindrome && r.LitresIsPalindrome && r.Pattern == "palindrome"
 }
 
 // isPalindrome checks if a number is palindromic
 func isPalindrome(n int) bool {
+	return isPalindromeInBase(n, 10)
+}
+
+// isPalindromeInBase checks if a number is palindromic when written in base,
+// which must be between 2 and 36
+func isPalindromeInBase(n, base int) bool {
 	if n < 0 {
 		return false
 	}
-	if n < 10 {
+	if n < base {
 		return true
 	}
 
@@ -58,8 +105,8 @@ func isPalindrome(n int) bool {
 	reversed := 0
 
 	for n > 0 {
-		reversed = reversed*10 + n%10
-		n /= 10
+		reversed = reversed*base + n%base
+		n /= base
 	}
 
 	return original == reversed
@@ -75,42 +122,157 @@ func isPalindromeString(s string) bool {
 	return true
 }
 
-// generatePalindromesForDigits generates all palindromic numbers with a given number of digits
-func generatePalindromesForDigits(digits int) []int {
-	var palindromes []int
+// Bases palindromes can be found in, from binary up to every digit and letter
+const (
+	MinBase = 2
+	MaxBase = 36
+)
 
-	if digits == 1 {
-		for i := 1; i <= 9; i++ {
-			palindromes = append(palindromes, i)
-		}
-		return palindromes
+// maxPalindromeDigits returns the most digits an int palindrome in base can
+// have without overflowing. Longer palindromes come from palindromesInRangeBig.
+func maxPalindromeDigits(base int) int {
+	return len(strconv.FormatInt(math.MaxInt, base)) - 1
+}
+
+// maxIntPalindromeDigits is maxPalindromeDigits in base ten
+var maxIntPalindromeDigits = maxPalindromeDigits(10)
+
+// makePalindrome builds the palindrome in base with the given number of
+// digits whose first half, middle digit included, is half
+func makePalindrome(half, digits, base int) int {
+	palindrome, rest := half, half
+	if digits%2 == 1 {
+		// Odd digits: mirror without center digit
+		rest /= base
+	}
+	for ; rest > 0; rest /= base {
+		palindrome = palindrome*base + rest%base
+	}
+	return palindrome
+}
+
+// powInt returns base^n for small non-negative n
+func powInt(base, n int) int {
+	result := 1
+	for i := 0; i < n; i++ {
+		result *= base
 	}
+	return result
+}
 
-	if digits == 2 {
-		for i := 1; i <= 9; i++ {
-			palindromes = append(palindromes, i*11)
-		}
-		return palindromes
+// PalindromeGenerator enumerates palindromic ints in ascending order from a
+// lower bound, using only arithmetic and without allocating. Each palindrome
+// is built by mirroring the next first half, so none are generated and then
+// filtered out. The zero value starts from 1 in base ten.
+type PalindromeGenerator struct {
+	base      int // base the palindromes read the same backwards in
+	maxDigits int // most digits a palindrome in base fits in an int with
+	half      int // first half of the next palindrome, middle digit included
+	halfEnd   int // first half that needs another digit
+	digits    int // digits in the next palindrome
+}
+
+// NewPalindromeGenerator returns a generator whose first palindrome is the
+// smallest one at or above from
+func NewPalindromeGenerator(from int) *PalindromeGenerator {
+	g, _ := NewPalindromeGeneratorInBase(from, 10)
+	return g
+}
+
+// NewPalindromeGeneratorInBase returns a generator of palindromes in base,
+// between MinBase and MaxBase, whose first palindrome is the smallest one at
+// or above from
+func NewPalindromeGeneratorInBase(from, base int) (*PalindromeGenerator, error) {
+	if err := validateBase(base); err != nil {
+		return nil, err
+	}
+	g := &PalindromeGenerator{base: base, maxDigits: maxPalindromeDigits(base)}
+	g.Seek(from)
+	return g, nil
+}
+
+// validateBase checks that palindromes can be read in base
+func validateBase(base int) error {
+	if base < MinBase || base > MaxBase {
+		return fmt.Errorf("base must be between %d and %d, got %d", MinBase, MaxBase, base)
+	}
+	return nil
+}
+
+// Seek moves the generator so that Next returns the smallest palindrome at
+// or above from
+func (g *PalindromeGenerator) Seek(from int) {
+	g.init()
+	from = max(from, 1)
+
+	digits := 1
+	for n := from; n >= g.base; n /= g.base {
+		digits++
+	}
+	if digits > g.maxDigits {
+		g.digits, g.half, g.halfEnd = digits, 0, 0
+		return
+	}
+
+	g.setDigits(digits)
+	g.half = from / powInt(g.base, digits-(digits+1)/2)
+	if makePalindrome(g.half, digits, g.base) < from {
+		g.advance()
 	}
+}
+
+// init makes the zero value generate base ten palindromes from 1
+func (g *PalindromeGenerator) init() {
+	if g.base == 0 {
+		g.base, g.maxDigits = 10, maxIntPalindromeDigits
+	}
+	if g.digits == 0 {
+		g.setDigits(1)
+	}
+}
 
+// setDigits starts the generator on the smallest palindrome with digits digits
+func (g *PalindromeGenerator) setDigits(digits int) {
 	halfDigits := (digits + 1) / 2
-	min := int(math.Pow(10, float64(halfDigits-1)))
-	max := int(math.Pow(10, float64(halfDigits))) - 1
+	g.digits = digits
+	g.half = powInt(g.base, halfDigits-1)
+	g.halfEnd = powInt(g.base, halfDigits)
+}
+
+// advance moves on to the next first half, adding a digit when they run out
+func (g *PalindromeGenerator) advance() {
+	g.half++
+	if g.half == g.halfEnd {
+		g.setDigits(g.digits + 1)
+	}
+}
 
-	for i := min; i <= max; i++ {
-		str := strconv.Itoa(i)
-		var palindrome string
+// Next returns the next palindrome, or false once they no longer fit in an int
+func (g *PalindromeGenerator) Next() (int, bool) {
+	g.init()
+	if g.digits > g.maxDigits {
+		return 0, false
+	}
 
-		if digits%2 == 0 {
-			// Even digits: mirror completely
-			palindrome = str + reverse(str)
-		} else {
-			// Odd digits: mirror without center digit
-			palindrome = str + reverse(str[:len(str)-1])
-		}
+	palindrome := makePalindrome(g.half, g.digits, g.base)
+	g.advance()
+	return palindrome, true
+}
+
+// generatePalindromesForDigits generates all palindromic numbers with a given
+// number of digits, or none if they wouldn't fit in an int
+func generatePalindromesForDigits(digits int) []int {
+	if digits < 1 || digits > maxIntPalindromeDigits {
+		return nil
+	}
 
-		num, _ := strconv.Atoi(palindrome)
-		palindromes = append(palindromes, num)
+	halfDigits := (digits + 1) / 2
+	palindromes := make([]int, 0, pow10(halfDigits)-pow10(halfDigits-1))
+
+	g := NewPalindromeGenerator(int(pow10(digits - 1)))
+	for len(palindromes) < cap(palindromes) {
+		p, _ := g.Next()
+		palindromes = append(palindromes, p)
 	}
 
 	return palindromes
@@ -125,340 +287,4700 @@ func reverse(s string) string {
 	return string(runes)
 }
 
-// getPalindromicPencesInRange gets all palindromic pence values in a range
+// getPalindromicPencesInRange gets all palindromic pence values in a range.
+// The generator starts at minPence, so the work is proportional to the
+// number of results.
 func getPalindromicPencesInRange(minPence, maxPence int) []int {
-	minDigits := len(strconv.Itoa(minPence))
-	maxDigits := len(strconv.Itoa(maxPence))
+	return palindromesInRange(minPence, maxPence, 10)
+}
 
+// palindromesInRange gets all palindromes in base from lo to hi, or none if
+// the base isn't supported
+func palindromesInRange(lo, hi, base int) []int {
 	var results []int
 
-	for d := minDigits; d <= maxDigits; d++ {
-		pals := generatePalindromesForDigits(d)
-		for _, pal := range pals {
-			if pal >= minPence && pal <= maxPence {
-				results = append(results, pal)
-			} else if pal > maxPence {
-				break
-			}
-		}
+	g, err := NewPalindromeGeneratorInBase(lo, base)
+	if err != nil {
+		return nil
+	}
+	for p, ok := g.Next(); ok && p <= hi; p, ok = g.Next() {
+		results = append(results, p)
 	}
 
 	return results
 }
 
-// formatPounds formats pence as pounds string
-func formatPounds(pence int) string {
-	pounds := float64(pence) / 100.0
-	return fmt.Sprintf("%.2f", pounds)
-}
-
-// isEffectivelyInteger checks if a float is close enough to an integer
-func isEffectivelyInteger(f float64, epsilon float64) bool {
-	return math.Abs(f-math.Round(f)) < epsilon
-}
-
-// FindPalindromicFuelCosts finds all palindromic fuel costs for a given price
-func FindPalindromicFuelCosts(pricePerLitre float64, maxLitres int, epsilon float64) []Result {
-	var results []Result
-
-	minPence := int(math.Floor(pricePerLitre))
-	maxPence := int(math.Ceil(float64(maxLitres) * pricePerLitre))
-
-	// Get all palindromic pence values
-	palindromicPences := getPalindromicPencesInRange(minPence, maxPence)
+// palindromesInRangeBig yields the palindromes in base from lo to hi in
+// ascending order, one at a time, for ranges too large to generate up front
+// or to fit in an int
+func palindromesInRangeBig(lo, hi *big.Int, base int) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		one := big.NewInt(1)
+		if lo.Sign() < 1 {
+			lo = one
+		}
+		minDigits, maxDigits := len(lo.Text(base)), len(hi.Text(base))
+		b := big.NewInt(int64(base))
 
-	// Pre-calculate reciprocal for faster division
-	reciprocalPrice := 1.0 / pricePerLitre
+		for d := minDigits; d <= maxDigits; d++ {
+			halfDigits := (d + 1) / 2
+			half := new(big.Int).Exp(b, big.NewInt(int64(halfDigits-1)), nil)
+			end := new(big.Int).Exp(b, big.NewInt(int64(halfDigits)), nil)
+			if d == minDigits {
+				half.SetString(lo.Text(base)[:halfDigits], base)
+			}
 
-	for _, pencePrice := range palindromicPences {
-		// Check if this palindromic pence is also palindromic as pounds
-		poundsStr := formatPounds(pencePrice)
-		if !isPalindromeString(poundsStr) {
-			continue
+			for ; half.Cmp(end) < 0; half.Add(half, one) {
+				digits := half.Text(base)
+				pal, _ := new(big.Int).SetString(digits+reverse(digits[:d/2]), base)
+				if pal.Cmp(hi) > 0 {
+					return
+				}
+				if pal.Cmp(lo) >= 0 && !yield(pal) {
+					return
+				}
+			}
 		}
+	}
+}
 
-		litres := float64(pencePrice) * reciprocalPrice
+// symbolPalindromesInRangeBig yields the amounts from lo to hi, in ascending
+// order, whose digits read the same backwards once the one facing the
+// currency symbol is dropped: the last digit when the symbol comes first,
+// or the first when it comes after. Amounts too short to have a leading
+// zero are yielded even where formatting pads them with one.
+func symbolPalindromesInRangeBig(lo, hi *big.Int, symbolAfter bool) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		one, ten := big.NewInt(1), big.NewInt(10)
+		if lo.Sign() < 1 {
+			lo = one
+		}
 
-		// Skip if exceeds max litres or less than 1
-		if litres > float64(maxLitres) {
-			break
+		// A lone digit faces the symbol with nothing left to read
+		n := new(big.Int).Set(lo)
+		for ; n.Cmp(ten) < 0; n = new(big.Int).Add(n, one) {
+			if n.Cmp(hi) > 0 || !yield(n) {
+				return
+			}
 		}
-		if litres < 1.0 {
-			continue
+
+		if !symbolAfter {
+			for p := range palindromesInRangeBig(new(big.Int).Quo(lo, ten), new(big.Int).Quo(hi, ten), 10) {
+				p.Mul(p, ten)
+				for d := int64(0); d < 10; d++ {
+					n := new(big.Int).Add(p, big.NewInt(d))
+					if n.Cmp(hi) > 0 {
+						return
+					}
+					if n.Cmp(lo) >= 0 && !yield(n) {
+						return
+					}
+				}
+			}
+			return
 		}
 
-		// Check if litres is effectively a whole number
-		if isEffectivelyInteger(litres, epsilon) {
-			wholeLitres := int(math.Round(litres))
-			results = append(results, Result{
-				Litres:             float64(wholeLitres),
-				CostPounds:         poundsStr,
-				LitresIsPalindrome: isPalindrome(wholeLitres),
-				Type:               "whole",
-			})
-		} else {
-			// Check if litres value itself is palindromic
-			litresRounded := math.Round(litres*100) / 100
-			litresStr := fmt.Sprintf("%.2f", litresRounded)
+		// The rest of the digits, after the first, may start with zeros
+		from := lo.Text(10)
+		for digits := max(len(from), 2); digits <= len(hi.Text(10)); digits++ {
+			rest := digits - 1
+			halfDigits := (rest + 1) / 2
+			for first := 1; first <= 9; first++ {
+				half, end := new(big.Int), new(big.Int).Exp(ten, big.NewInt(int64(halfDigits)), nil)
+				if digits == len(from) {
+					if first < int(from[0]-'0') {
+						continue
+					}
+					if first == int(from[0]-'0') {
+						half.SetString(from[1:1+halfDigits], 10)
+					}
+				}
 
-			if isPalindromeString(litresStr) {
-				results = append(results, Result{
-					Litres:             litresRounded,
-					CostPounds:         poundsStr,
-					LitresIsPalindrome: true,
-					Type:               "palindromic_decimal",
-				})
+				for ; half.Cmp(end) < 0; half.Add(half, one) {
+					h := fmt.Sprintf("%0*s", halfDigits, half.Text(10))
+					n, _ := new(big.Int).SetString(strconv.Itoa(first)+h+reverse(h[:rest/2]), 10)
+					if n.Cmp(hi) > 0 {
+						return
+					}
+					if n.Cmp(lo) >= 0 && !yield(n) {
+						return
+					}
+				}
 			}
 		}
 	}
+}
 
-	return results
+// pow10 returns 10^n for small non-negative n
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
 }
 
-// FindNearestPalindromicCost finds the nearest palindromic cost to a target amount
-func FindNearestPalindromicCost(pricePerLitre float64, targetLitres float64, searchRadius int, epsilon float64) *Result {
-	minLitres := int(math.Max(1, targetLitres-float64(searchRadius)))
-	maxLitres := int(targetLitres + float64(searchRadius))
+// formatMinor formats an amount held in minor units (pence, centilitres)
+// with the given number of decimal places
+func formatMinor(units int64, decimals int) string {
+	return formatMinorBig(big.NewInt(units), decimals)
+}
 
-	results := FindPalindromicFuelCosts(pricePerLitre, maxLitres, epsilon)
+// formatMinorBig is formatMinor for amounts of any size
+func formatMinorBig(units *big.Int, decimals int) string {
+	digits := units.String()
+	if decimals <= 0 {
+		return digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	return digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
 
-	var nearest *Result
-	minDiff := math.MaxFloat64
+// formatPounds formats pence as pounds string
+func formatPounds(pence int) string {
+	return GBP.FormatAmount(int64(pence))
+}
 
-	for i := range results {
-		if results[i].Litres < float64(minLitres) {
-			continue
+// Currency describes how a pump writes an amount of money
+type Currency struct {
+	Code        string `json:"code"`
+	Symbol      string `json:"symbol"`
+	MinorUnits  int    `json:"minorUnits"`  // digits after the decimal separator
+	MinorSymbol string `json:"minorSymbol"` // label for prices in minor units, like p
+	Decimal     string `json:"decimal"`     // decimal separator
+	Grouping    string `json:"grouping"`    // thousands separator, empty for none
+	SymbolAfter bool   `json:"symbolAfter"` // write 50,05 € rather than €50,05
+}
+
+// Built-in currencies, written the way fuel pumps in each country show them.
+// Pumps don't group thousands, so none of these set Grouping.
+var (
+	GBP = Currency{Code: "GBP", Symbol: "£", MinorUnits: 2, MinorSymbol: "p", Decimal: "."}
+	EUR = Currency{Code: "EUR", Symbol: "€", MinorUnits: 2, MinorSymbol: "c", Decimal: ",", SymbolAfter: true}
+	USD = Currency{Code: "USD", Symbol: "$", MinorUnits: 2, MinorSymbol: "¢", Decimal: "."}
+	JPY = Currency{Code: "JPY", Symbol: "¥", MinorUnits: 0, MinorSymbol: "¥", Decimal: "."}
+	KWD = Currency{Code: "KWD", Symbol: "KD", MinorUnits: 3, MinorSymbol: " fils", Decimal: "."}
+)
+
+// currencies lists the built-in currencies in the order they are offered
+var currencies = []Currency{GBP, EUR, USD, JPY, KWD}
+
+// ParseCurrency returns the built-in currency with the given ISO code,
+// defaulting to pounds sterling
+func ParseCurrency(code string) (Currency, error) {
+	if code == "" {
+		return GBP, nil
+	}
+	for _, c := range currencies {
+		if strings.EqualFold(code, c.Code) {
+			return c, nil
 		}
+	}
+	codes := make([]string, len(currencies))
+	for i, c := range currencies {
+		codes[i] = c.Code
+	}
+	return Currency{}, fmt.Errorf("unknown currency %q (want %s)", code, strings.Join(codes, ", "))
+}
 
-		diff := math.Abs(results[i].Litres - targetLitres)
-		if diff < minDiff {
-			minDiff = diff
-			nearest = &results[i]
+// currencyByCode returns the built-in currency for a result, falling back to
+// pounds for results that don't name one
+func currencyByCode(code string) Currency {
+	c, err := ParseCurrency(code)
+	if err != nil {
+		return GBP
+	}
+	return c
+}
+
+// Validate checks that the currency can be formatted unambiguously
+func (c Currency) Validate() error {
+	if c.MinorUnits < 0 || c.MinorUnits > 4 {
+		return fmt.Errorf("minor units must be between 0 and 4, got %d", c.MinorUnits)
+	}
+	if c.MinorUnits > 0 && c.Decimal == "" {
+		return fmt.Errorf("currency %s needs a decimal separator", c.Code)
+	}
+	if c.Grouping != "" && c.Grouping == c.Decimal {
+		return fmt.Errorf("currency %s uses %q for both grouping and decimals", c.Code, c.Grouping)
+	}
+	return nil
+}
+
+// FormatAmount formats an amount in minor units without the currency
+// symbol, as in 50,05 for 5005 euro cents
+func (c Currency) FormatAmount(units int64) string {
+	return c.formatAmountBig(big.NewInt(units))
+}
+
+// formatAmountBig is FormatAmount for amounts of any size
+func (c Currency) formatAmountBig(units *big.Int) string {
+	amount := formatMinorBig(units, c.MinorUnits)
+	major, minor, _ := strings.Cut(amount, ".")
+	if c.Grouping != "" {
+		for i := len(major) - 3; i > 0; i -= 3 {
+			major = major[:i] + c.Grouping + major[i:]
 		}
 	}
+	if c.MinorUnits == 0 {
+		return major
+	}
+	return major + c.Decimal + minor
+}
 
-	return nearest
+// withSymbol adds the currency symbol to a formatted amount
+func (c Currency) withSymbol(amount string) string {
+	if c.SymbolAfter {
+		return amount + " " + c.Symbol
+	}
+	return c.Symbol + amount
 }
 
-// FindPalindromicCostForTarget finds palindromic costs near a target price
-func FindPalindromicCostForTarget(pricePerLitre float64, targetPounds float64, searchRadiusPence int, epsilon float64) []Result {
-	var results []Result
+// Format formats an amount in minor units as printed on a receipt
+func (c Currency) Format(units int64) string {
+	return c.withSymbol(c.FormatAmount(units))
+}
 
-	targetPence := int(math.Round(targetPounds * 100))
-	minPence := targetPence - searchRadiusPence
-	maxPence := targetPence + searchRadiusPence
+// parseAmount reads back an amount written by FormatAmount in major units
+func (c Currency) parseAmount(s string) float64 {
+	if c.Grouping != "" {
+		s = strings.ReplaceAll(s, c.Grouping, "")
+	}
+	if c.Decimal != "" {
+		s = strings.Replace(s, c.Decimal, ".", 1)
+	}
+	return parseFloat(s)
+}
 
-	if minPence < 1 {
-		minPence = 1
+// formatPrice formats a price per unit given in minor units
+func (c Currency) formatPrice(price Price) string {
+	if c.MinorUnits == 0 {
+		return c.Symbol + price.String()
 	}
+	return price.String() + c.MinorSymbol
+}
 
-	// Get palindromic pences in range
-	palindromicPences := getPalindromicPencesInRange(minPence, maxPence)
-	reciprocalPrice := 1.0 / pricePerLitre
+// VolumeUnit is the unit a pump meters fuel in and prices are quoted per
+type VolumeUnit struct {
+	Code       string `json:"code"`
+	Singular   string `json:"singular"`         // like litre, for prices per unit
+	Plural     string `json:"plural"`           // like litres, for amounts
+	Symbol     string `json:"symbol"`           // like L, for compact display
+	Decimals   int    `json:"decimals"`         // decimal places pumps usually display
+	Nanolitres int64  `json:"nanolitres"`       // exact size of one unit, or microwatt-hours for energy
+	Energy     bool   `json:"energy,omitempty"` // measures electricity rather than fuel
+}
 
-	for _, pencePrice := range palindromicPences {
-		poundsStr := formatPounds(pencePrice)
-		if !isPalindromeString(poundsStr) {
-			continue
-		}
+// Built-in volume units. Many US pumps show gallons to three decimals, and
+// chargers usually show kilowatt-hours to two.
+var (
+	Litres          = VolumeUnit{Code: "litres", Singular: "litre", Plural: "litres", Symbol: "L", Decimals: 2, Nanolitres: 1000000000}
+	USGallons       = VolumeUnit{Code: "us-gallons", Singular: "gallon", Plural: "gallons", Symbol: "gal", Decimals: 3, Nanolitres: 3785411784}
+	ImperialGallons = VolumeUnit{Code: "imperial-gallons", Singular: "gallon", Plural: "gallons", Symbol: "gal", Decimals: 2, Nanolitres: 4546090000}
+	KilowattHours   = VolumeUnit{Code: "kwh", Singular: "kWh", Plural: "kWh", Symbol: "kWh", Decimals: 2, Nanolitres: 1000000000, Energy: true}
+)
 
-		litres := float64(pencePrice) * reciprocalPrice
+// volumeUnits lists the built-in units in the order they are offered
+var volumeUnits = []VolumeUnit{Litres, USGallons, ImperialGallons, KilowattHours}
 
-		if litres < 1.0 {
-			continue
+// ParseVolumeUnit returns the built-in unit with the given code, defaulting
+// to litres
+func ParseVolumeUnit(code string) (VolumeUnit, error) {
+	if code == "" {
+		return Litres, nil
+	}
+	for _, u := range volumeUnits {
+		if strings.EqualFold(code, u.Code) {
+			return u, nil
 		}
+	}
+	return VolumeUnit{}, fmt.Errorf("unknown volume unit %q (want litres, us-gallons, imperial-gallons or kwh)", code)
+}
 
-		if isEffectivelyInteger(litres, epsilon) {
-			wholeLitres := int(math.Round(litres))
-			results = append(results, Result{
-				Litres:             float64(wholeLitres),
-				CostPounds:         poundsStr,
-				LitresIsPalindrome: isPalindrome(wholeLitres),
-				Type:               "whole",
-			})
-		} else {
-			litresRounded := math.Round(litres*100) / 100
-			litresStr := fmt.Sprintf("%.2f", litresRounded)
+// volumeUnitByCode returns the built-in unit for a result, falling back to
+// litres for results that don't name one
+func volumeUnitByCode(code string) VolumeUnit {
+	u, err := ParseVolumeUnit(code)
+	if err != nil {
+		return Litres
+	}
+	return u
+}
 
-			if isPalindromeString(litresStr) {
-				results = append(results, Result{
-					Litres:             litresRounded,
-					CostPounds:         poundsStr,
-					LitresIsPalindrome: true,
-					Type:               "palindromic_decimal",
-				})
-			}
-		}
+// WindowSymbol is the symbol stop windows are measured in: millilitres for
+// fuel, watt-hours for energy
+func (u VolumeUnit) WindowSymbol() string {
+	if u.Energy {
+		return "Wh"
 	}
+	return "ml"
+}
 
-	return results
+// title capitalises a unit name for a column heading, leaving symbols like
+// kWh as they are
+func (u VolumeUnit) title(name string) string {
+	if u.Energy {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
 }
 
-// BatchFindPalindromicCosts processes multiple fuel prices concurrently
-func BatchFindPalindromicCosts(prices []float64, maxLitres int, epsilon float64) map[float64][]Result {
-	results := make(map[float64][]Result)
-	var mu sync.Mutex
-	var wg sync.WaitGroup
+// Validate checks that the unit has a size and a display precision
+func (u VolumeUnit) Validate() error {
+	if u.Nanolitres <= 0 {
+		return fmt.Errorf("volume unit %s needs a positive size", u.Code)
+	}
+	if u.Decimals < 0 || u.Decimals > 6 {
+		return fmt.Errorf("volume decimals must be between 0 and 6, got %d", u.Decimals)
+	}
+	return nil
+}
 
-	for _, price := range prices {
-		wg.Add(1)
-		go func(p float64) {
-			defer wg.Done()
-			res := FindPalindromicFuelCosts(p, maxLitres, epsilon)
-			mu.Lock()
-			results[p] = res
-			mu.Unlock()
-		}(price)
+// exactDecimal converts a float64 into an exact rational using its shortest
+// decimal representation, so 128.9 becomes 1289/10 rather than the nearest
+// binary fraction. It returns nil for NaN and infinities.
+func exactDecimal(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return nil
 	}
+	return r
+}
 
-	wg.Wait()
-	return results
+// ratFloat converts a rational to the nearest float64 for reporting
+func ratFloat(r *big.Rat) float64 {
+	f, _ := r.Float64()
+	return f
 }
 
-// Web server types and handlers
-type CalculateRequest struct {
-	PricePerLitre float64 `json:"pricePerLitre"`
-	MaxLitres     int     `json:"maxLitres"`
+// Price is a price per volume unit in minor currency units, held as the
+// decimal text it was given in so that prices like 128.95 or 359.9999 are
+// searched exactly and reported unchanged
+type Price string
+
+// ParsePrice parses a positive decimal price such as 128.9 or 359.999.
+// Leading zeros are dropped, so the price is also a valid JSON number.
+func ParsePrice(s string) (Price, error) {
+	s = strings.TrimSpace(s)
+	digits := strings.Replace(s, ".", "", 1)
+	if digits == "" || digitsOnly(digits) != digits || strings.HasSuffix(s, ".") || strings.HasPrefix(s, ".") {
+		return "", fmt.Errorf("invalid price %q (want a decimal number like 128.9)", s)
+	}
+	if trimmed := strings.TrimLeft(s, "0"); trimmed == "" || trimmed[0] == '.' {
+		s = "0" + trimmed
+	} else {
+		s = trimmed
+	}
+	p := Price(s)
+	if p.Rat().Sign() <= 0 {
+		return "", fmt.Errorf("price must be positive, got %s", s)
+	}
+	return p, nil
 }
 
-type CalculateResponse struct {
-	Results []Result `json:"results"`
-	Error   string   `json:"error,omitempty"`
+// PriceFromFloat converts a float price using its shortest decimal
+// representation, so 128.9 becomes exactly 128.9
+func PriceFromFloat(f float64) Price {
+	return Price(strconv.FormatFloat(f, 'f', -1, 64))
 }
 
-type TemplateData struct {
-	Results []DisplayResult
-	Error   string
-	Request CalculateRequest
-	BaseURL string
+// Rat returns the exact value of the price, or nil if it isn't a number
+func (p Price) Rat() *big.Rat {
+	r, ok := new(big.Rat).SetString(string(p))
+	if !ok {
+		return nil
+	}
+	return r
 }
 
-type DisplayResult struct {
-	Result
-	FormattedLitres string
+// Float64 returns the price as the nearest float64
+func (p Price) Float64() float64 {
+	if r := p.Rat(); r != nil {
+		return ratFloat(r)
+	}
+	return 0
 }
 
-// handleAPI handles the REST API endpoint
-func handleAPI(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// String returns the price exactly as given
+func (p Price) String() string { return string(p) }
 
-	if r.Method == "OPTIONS" {
-		return
+// IsPalindrome reports whether the price's digits read the same backwards,
+// ignoring the decimal point, so 133.1 and 128.821 do
+func (p Price) IsPalindrome() bool {
+	digits := digitsOnly(string(p))
+	return digits != "" && isPalindromeString(digits)
+}
+
+// MarshalJSON writes the price as a JSON number with its original digits
+func (p Price) MarshalJSON() ([]byte, error) {
+	if p == "" {
+		return []byte("null"), nil
 	}
+	return []byte(p), nil
+}
 
-	if r.Method != "POST" && r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// UnmarshalJSON reads a price from a JSON number or string, keeping every
+// digit rather than rounding through float64
+func (p *Price) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
 	}
+	price, err := ParsePrice(s)
+	if err != nil {
+		return err
+	}
+	*p = price
+	return nil
+}
 
-	var req CalculateRequest
-	if r.Method == "POST" {
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid JSON"})
-			return
-		}
-	} else {
-		// GET request - parse query parameters
-		priceStr := r.URL.Query().Get("price")
-		maxStr := r.URL.Query().Get("max")
+// PriceRange is a run of pump prices from Min to Max inclusive, Step apart,
+// written min:max:step like 120:160:0.1
+type PriceRange struct {
+	Min  Price `json:"min"`
+	Max  Price `json:"max"`
+	Step Price `json:"step"`
+}
 
-		if priceStr == "" || maxStr == "" {
-			json.NewEncoder(w).Encode(CalculateResponse{Error: "Missing price or max parameters"})
-			return
-		}
+// DefaultPriceRange covers typical UK pump prices to a tenth of a penny
+var DefaultPriceRange = PriceRange{Min: "120.0", Max: "160.0", Step: "0.1"}
 
-		price, err := strconv.ParseFloat(priceStr, 64)
-		if err != nil {
-			json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid price parameter"})
-			return
-		}
+// maxPriceRangeLen is the most prices a range may hold
+const maxPriceRangeLen = 100000
+
+// ParsePriceRange parses a range written min:max:step, or min:max to use
+// the step of DefaultPriceRange
+func ParsePriceRange(s string) (PriceRange, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return PriceRange{}, fmt.Errorf("invalid price range %q (want min:max:step, like 120:160:0.1)", s)
+	}
+	if len(parts) == 2 {
+		parts = append(parts, DefaultPriceRange.Step.String())
+	}
 
-		max, err := strconv.Atoi(maxStr)
+	var prices [3]Price
+	for i, part := range parts {
+		price, err := ParsePrice(part)
 		if err != nil {
-			json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid max parameter"})
-			return
+			return PriceRange{}, fmt.Errorf("invalid price range %q: %w", s, err)
 		}
-
-		req = CalculateRequest{PricePerLitre: price, MaxLitres: max}
+		prices[i] = price
 	}
 
-	results := FindPalindromicFuelCosts(req.PricePerLitre, req.MaxLitres, 0.01)
-	json.NewEncoder(w).Encode(CalculateResponse{Results: results})
+	r := PriceRange{Min: prices[0], Max: prices[1], Step: prices[2]}
+	return r, r.Validate()
 }
 
-// handleWebUI handles the web interface
-func handleWebUI(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" && r.URL.Path != "" {
-		http.NotFound(w, r)
-		return
-	}
+// String writes the range as ParsePriceRange reads it
+func (r PriceRange) String() string {
+	return r.Min.String() + ":" + r.Max.String() + ":" + r.Step.String()
+}
 
-	// Construct base URL from request
-	scheme := "http"
-	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-		scheme = "https"
+// Validate checks that the range holds between one and maxPriceRangeLen prices
+func (r PriceRange) Validate() error {
+	lo, hi, step := r.Min.Rat(), r.Max.Rat(), r.Step.Rat()
+	if lo == nil || hi == nil || step == nil || lo.Sign() <= 0 || step.Sign() <= 0 {
+		return fmt.Errorf("price range %s needs positive prices and step", r)
 	}
-	baseURL := scheme + "://" + r.Host
-
-	data := TemplateData{
-		BaseURL: baseURL,
+	if lo.Cmp(hi) > 0 {
+		return fmt.Errorf("price range %s ends before it starts", r)
 	}
+	if n := r.len(); n.Cmp(big.NewInt(maxPriceRangeLen)) > 0 {
+		return fmt.Errorf("price range %s holds %s prices, more than %d", r, n, maxPriceRangeLen)
+	}
+	return nil
+}
 
-	if r.Method == "POST" {
-		r.ParseForm()
-		priceStr := r.FormValue("price")
+// len returns how many prices the range holds
+func (r PriceRange) len() *big.Int {
+	span := new(big.Rat).Sub(r.Max.Rat(), r.Min.Rat())
+	span.Quo(span, r.Step.Rat())
+	n := new(big.Int).Quo(span.Num(), span.Denom())
+	return n.Add(n, big.NewInt(1))
+}
+
+// Prices yields the prices in the range in ascending order, written to as
+// many decimals as Min and Step have. It yields nothing if the range is
+// invalid.
+func (r PriceRange) Prices() iter.Seq[Price] {
+	return func(yield func(Price) bool) {
+		if r.Validate() != nil {
+			return
+		}
+
+		decimals := max(decimalPlaces(r.Min.String()), decimalPlaces(r.Step.String()))
+		hi, step := r.Max.Rat(), r.Step.Rat()
+		for p := r.Min.Rat(); p.Cmp(hi) <= 0; p.Add(p, step) {
+			if !yield(Price(p.FloatString(decimals))) {
+				return
+			}
+		}
+	}
+}
+
+// decimalPlaces counts the digits after the decimal point of a number
+func decimalPlaces(s string) int {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// RoundingRule is how a pump rounds a value to its display precision
+type RoundingRule string
+
+const (
+	// RoundHalfUp rounds to the nearest step, halves away from zero
+	RoundHalfUp RoundingRule = "half-up"
+	// RoundHalfEven rounds to the nearest step, halves to the even neighbour
+	RoundHalfEven RoundingRule = "half-even"
+	// RoundUp always rounds up to the next step
+	RoundUp RoundingRule = "up"
+	// RoundDown always truncates to the step below
+	RoundDown RoundingRule = "down"
+)
+
+// roundingRules lists the supported rules in the order they are offered
+var roundingRules = []RoundingRule{RoundHalfUp, RoundHalfEven, RoundUp, RoundDown}
+
+// ParseRoundingRule parses a rounding rule name, defaulting to half-up
+func ParseRoundingRule(s string) (RoundingRule, error) {
+	if s == "" {
+		return RoundHalfUp, nil
+	}
+	for _, rule := range roundingRules {
+		if strings.EqualFold(s, string(rule)) {
+			return rule, nil
+		}
+	}
+	return "", fmt.Errorf("unknown rounding rule %q (want half-up, half-even, up or down)", s)
+}
+
+// round rounds a non-negative rational to a whole number under this rule
+func (rule RoundingRule) round(r *big.Rat) *big.Int {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() == 0 || rule == RoundDown {
+		return q
+	}
+	if rule == RoundUp {
+		return q.Add(q, big.NewInt(1))
+	}
+
+	// Compare the remainder with half the denominator
+	half := m.Lsh(m, 1).Cmp(r.Denom())
+	if half > 0 || (half == 0 && (rule == RoundHalfUp || q.Bit(0) == 1)) {
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+// lowerBound returns the smallest value this rule rounds to n or more, and
+// whether that value itself rounds to n (rather than only values above it)
+func (rule RoundingRule) lowerBound(n *big.Int) (*big.Rat, bool) {
+	bound := new(big.Rat).SetInt(n)
+	switch rule {
+	case RoundDown:
+		return bound, true
+	case RoundUp:
+		return bound.Sub(bound, big.NewRat(1, 1)), false
+	case RoundHalfEven:
+		return bound.Sub(bound, big.NewRat(1, 2)), n.Bit(0) == 0
+	default:
+		return bound.Sub(bound, big.NewRat(1, 2)), true
+	}
+}
+
+// CostBasis says which volume a pump multiplies by the price
+type CostBasis string
+
+const (
+	// CostFromMetered prices the exact metered volume
+	CostFromMetered CostBasis = "metered"
+	// CostFromDisplayed prices the rounded volume shown on the display
+	CostFromDisplayed CostBasis = "displayed"
+)
+
+// ParseCostBasis parses a cost basis name, defaulting to metered
+func ParseCostBasis(s string) (CostBasis, error) {
+	switch strings.ToLower(s) {
+	case "", string(CostFromMetered):
+		return CostFromMetered, nil
+	case string(CostFromDisplayed):
+		return CostFromDisplayed, nil
+	}
+	return "", fmt.Errorf("unknown cost basis %q (want metered or displayed)", s)
+}
+
+// UnitVolumeDecimals asks for volumes at the usual display precision of the
+// search's volume unit
+const UnitVolumeDecimals = -1
+
+// PumpModel describes how a pump turns the metered volume into the litres
+// and cost printed on the receipt. Costs are displayed to the minor unit of
+// the search's currency.
+type PumpModel struct {
+	VolumeDecimals int          `json:"volumeDecimals"`
+	VolumeRounding RoundingRule `json:"volumeRounding"`
+	CostRounding   RoundingRule `json:"costRounding"`
+	CostBasis      CostBasis    `json:"costBasis"`
+}
+
+// DefaultPumpModel is a typical pump: volume at the unit's usual precision,
+// with volume and cost both rounded half up, with the cost worked out from the exact
+// metered volume
+var DefaultPumpModel = PumpModel{
+	VolumeDecimals: UnitVolumeDecimals,
+	VolumeRounding: RoundHalfUp,
+	CostRounding:   RoundHalfUp,
+	CostBasis:      CostFromMetered,
+}
+
+// UnmarshalJSON fills any fields missing from the JSON from DefaultPumpModel
+func (m *PumpModel) UnmarshalJSON(data []byte) error {
+	type plain PumpModel
+	p := plain(DefaultPumpModel)
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*m = PumpModel(p)
+	return nil
+}
+
+// parsePumpModel builds a pump model from its textual settings, as given on
+// the command line or in a query string
+func parsePumpModel(volumeDecimals int, volumeRounding, costRounding, costBasis string) (PumpModel, error) {
+	pump := DefaultPumpModel
+	pump.VolumeDecimals = volumeDecimals
+
+	var err error
+	if pump.VolumeRounding, err = ParseRoundingRule(volumeRounding); err != nil {
+		return pump, err
+	}
+	if pump.CostRounding, err = ParseRoundingRule(costRounding); err != nil {
+		return pump, err
+	}
+	if pump.CostBasis, err = ParseCostBasis(costBasis); err != nil {
+		return pump, err
+	}
+	return pump, pump.Validate()
+}
+
+// Validate checks that the model describes a pump display we can simulate
+func (m PumpModel) Validate() error {
+	if m.VolumeDecimals < UnitVolumeDecimals || m.VolumeDecimals > 6 {
+		return fmt.Errorf("volume decimals must be between 0 and 6, got %d", m.VolumeDecimals)
+	}
+	for _, rule := range []RoundingRule{m.VolumeRounding, m.CostRounding} {
+		if _, err := ParseRoundingRule(string(rule)); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseCostBasis(string(m.CostBasis)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PalindromeMode selects which characters of a formatted amount have to read
+// the same backwards
+type PalindromeMode string
+
+const (
+	// PalindromeLiteral compares the amount exactly as formatted, decimal
+	// point included, so only totals like £50.05 qualify
+	PalindromeLiteral PalindromeMode = "literal"
+	// PalindromeDigits ignores the decimal separator, so £123.21 (12321p)
+	// qualifies too
+	PalindromeDigits PalindromeMode = "digits"
+	// PalindromeSymbol reads the digits with the currency symbol in its
+	// place on the receipt. The symbol takes up one character, however
+	// it's written, and pairs with whichever digit faces it, so £12.13
+	// (£1213) qualifies but £1.21 (£121) doesn't.
+	PalindromeSymbol PalindromeMode = "symbol"
+)
+
+// palindromeModes lists the supported modes in the order they are offered
+var palindromeModes = []PalindromeMode{PalindromeLiteral, PalindromeDigits, PalindromeSymbol}
+
+// ParsePalindromeMode parses a palindrome mode name, defaulting to literal
+func ParsePalindromeMode(s string) (PalindromeMode, error) {
+	if s == "" {
+		return PalindromeLiteral, nil
+	}
+	for _, mode := range palindromeModes {
+		if strings.EqualFold(s, string(mode)) {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown palindrome mode %q (want literal, digits or symbol)", s)
+}
+
+// digitsOnly strips everything but ASCII digits from s
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// matchesCost checks if a cost formatted in currency c is palindromic under
+// this mode
+func (m PalindromeMode) matchesCost(cost string, c Currency) bool {
+	switch m {
+	case PalindromeDigits:
+		return isPalindromeString(digitsOnly(cost))
+	case PalindromeSymbol:
+		digits := digitsOnly(cost)
+		if c.SymbolAfter {
+			return isPalindromeString(digits[1:])
+		}
+		return isPalindromeString(digits[:len(digits)-1])
+	default:
+		return isPalindromeString(cost)
+	}
+}
+
+// NumberPattern is a family of satisfying amounts that a search looks for
+type NumberPattern interface {
+	// Name identifies the pattern on the command line and in the API
+	Name() string
+	// Candidates returns, in ascending order, the amounts in minor units
+	// between lo and hi inclusive that might match. Amounts are at least one
+	// major unit, and decimals is the number of minor unit digits.
+	Candidates(lo, hi, decimals int) []int
+	// Matches tests an amount formatted as the pump displays it
+	Matches(formatted string) bool
+}
+
+// PairedPattern is a NumberPattern that also constrains the litres printed
+// alongside the cost. Only readings that satisfy MatchesPair are reported,
+// whole litres included.
+type PairedPattern interface {
+	NumberPattern
+	MatchesPair(cost, litres string) bool
+}
+
+// BigNumberPattern is a NumberPattern that can also generate its candidates
+// lazily as big integers. Searches use it for ranges too large to generate
+// up front, including costs past the largest int; patterns without it can
+// only search up to there.
+type BigNumberPattern interface {
+	NumberPattern
+	// CandidatesBig yields, in ascending order, the amounts between lo and
+	// hi inclusive that might match
+	CandidatesBig(lo, hi *big.Int, decimals int) iter.Seq[*big.Int]
+}
+
+// PalindromePattern matches amounts that read the same backwards. In bases
+// other than ten it is the whole amount in minor units that has to, written
+// in that base, and Mode doesn't apply.
+type PalindromePattern struct {
+	Mode     PalindromeMode
+	Currency Currency // symbol used by PalindromeSymbol, pounds if unset
+	Base     int      // between MinBase and MaxBase, ten if unset
+}
+
+// Name implements NumberPattern
+func (p PalindromePattern) Name() string { return "palindrome" }
+
+// base returns the base the pattern reads amounts in
+func (p PalindromePattern) base() int {
+	if p.Base == 0 {
+		return 10
+	}
+	return p.Base
+}
+
+// Validate checks that the pattern's base is supported
+func (p PalindromePattern) Validate() error {
+	return validateBase(p.base())
+}
+
+// currency returns the currency whose symbol PalindromeSymbol reads
+func (p PalindromePattern) currency() Currency {
+	if p.Currency.Code == "" {
+		return GBP
+	}
+	return p.Currency
+}
+
+// bySymbol reports whether the pattern reads amounts with their symbol
+func (p PalindromePattern) bySymbol() bool {
+	return p.Mode == PalindromeSymbol && p.base() == 10
+}
+
+// Candidates implements NumberPattern
+func (p PalindromePattern) Candidates(lo, hi, decimals int) []int {
+	if p.bySymbol() {
+		var results []int
+		for n := range p.CandidatesBig(big.NewInt(int64(lo)), big.NewInt(int64(hi)), decimals) {
+			results = append(results, int(n.Int64()))
+		}
+		return results
+	}
+	return palindromesInRange(lo, hi, p.base())
+}
+
+// CandidatesBig implements BigNumberPattern
+func (p PalindromePattern) CandidatesBig(lo, hi *big.Int, decimals int) iter.Seq[*big.Int] {
+	if p.bySymbol() {
+		return symbolPalindromesInRangeBig(lo, hi, p.currency().SymbolAfter)
+	}
+	return palindromesInRangeBig(lo, hi, p.base())
+}
+
+// Matches implements NumberPattern
+func (p PalindromePattern) Matches(formatted string) bool {
+	if p.base() != 10 {
+		return isPalindromeString(p.represent(formatted))
+	}
+	return p.Mode.matchesCost(formatted, p.currency())
+}
+
+// represent writes a formatted amount's minor units in the pattern's base
+func (p PalindromePattern) represent(formatted string) string {
+	units, ok := new(big.Int).SetString(digitsOnly(formatted), 10)
+	if !ok {
+		return ""
+	}
+	return units.Text(p.base())
+}
+
+// RepdigitPattern matches amounts made of one repeated digit, like £44.44
+type RepdigitPattern struct{}
+
+// Name implements NumberPattern
+func (RepdigitPattern) Name() string { return "repdigit" }
+
+// Candidates implements NumberPattern
+func (RepdigitPattern) Candidates(lo, hi, decimals int) []int {
+	var results []int
+	for ones := 1; ones <= hi && ones > 0; ones = ones*10 + 1 {
+		for d := 1; d <= 9; d++ {
+			if n := ones * d; n >= lo && n <= hi {
+				results = append(results, n)
+			}
+		}
+	}
+	return results
+}
+
+// CandidatesBig implements BigNumberPattern
+func (RepdigitPattern) CandidatesBig(lo, hi *big.Int, decimals int) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		ones := big.NewInt(1)
+		for ones.Cmp(hi) <= 0 {
+			for d := int64(1); d <= 9; d++ {
+				n := new(big.Int).Mul(ones, big.NewInt(d))
+				if n.Cmp(hi) > 0 {
+					return
+				}
+				if n.Cmp(lo) >= 0 && !yield(n) {
+					return
+				}
+			}
+			ones.Mul(ones, big.NewInt(10)).Add(ones, big.NewInt(1))
+		}
+	}
+}
+
+// Matches implements NumberPattern
+func (RepdigitPattern) Matches(formatted string) bool {
+	digits := digitsOnly(formatted)
+	return len(digits) > 1 && strings.Count(digits, digits[:1]) == len(digits)
+}
+
+// RunPattern matches amounts whose digits count up, like £12.34, or down,
+// like £43.21, one step at a time
+type RunPattern struct {
+	Descending bool
+}
+
+// Name implements NumberPattern
+func (p RunPattern) Name() string {
+	if p.Descending {
+		return "descending"
+	}
+	return "ascending"
+}
+
+// Candidates implements NumberPattern
+func (p RunPattern) Candidates(lo, hi, decimals int) []int {
+	var results []int
+	for length := 2; length <= 10; length++ {
+		for first := 0; first <= 9; first++ {
+			n, digit := 0, first
+			for i := 0; i < length && digit >= 0 && digit <= 9; i++ {
+				n = n*10 + digit
+				if p.Descending {
+					digit--
+				} else {
+					digit++
+				}
+			}
+			if first > 0 && len(strconv.Itoa(n)) == length && n >= lo && n <= hi {
+				results = append(results, n)
+			}
+		}
+	}
+	sort.Ints(results)
+	return results
+}
+
+// CandidatesBig implements BigNumberPattern. Runs have at most ten digits,
+// so every one of them fits in an int.
+func (p RunPattern) CandidatesBig(lo, hi *big.Int, decimals int) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		if !lo.IsInt64() {
+			return
+		}
+		top := int64(math.MaxInt)
+		if hi.IsInt64() {
+			top = hi.Int64()
+		}
+		for _, n := range p.Candidates(int(lo.Int64()), int(top), decimals) {
+			if !yield(big.NewInt(int64(n))) {
+				return
+			}
+		}
+	}
+}
+
+// Matches implements NumberPattern
+func (p RunPattern) Matches(formatted string) bool {
+	digits := digitsOnly(formatted)
+	if len(digits) < 2 {
+		return false
+	}
+	step := byte(1)
+	if p.Descending {
+		step = 0xff // wraps to -1 when added to a byte
+	}
+	for i := 1; i < len(digits); i++ {
+		if digits[i] != digits[i-1]+step {
+			return false
+		}
+	}
+	return true
+}
+
+// RoundPattern matches whole amounts of the major unit, like £50.00
+type RoundPattern struct{}
+
+// Name implements NumberPattern
+func (RoundPattern) Name() string { return "round" }
+
+// Candidates implements NumberPattern
+func (RoundPattern) Candidates(lo, hi, decimals int) []int {
+	var results []int
+	unit := int(pow10(decimals))
+	for n := (lo + unit - 1) / unit * unit; n <= hi; n += unit {
+		results = append(results, n)
+	}
+	return results
+}
+
+// CandidatesBig implements BigNumberPattern
+func (RoundPattern) CandidatesBig(lo, hi *big.Int, decimals int) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+		n := new(big.Int).Add(lo, unit)
+		n.Sub(n, big.NewInt(1)).Quo(n, unit).Mul(n, unit)
+		for ; n.Cmp(hi) <= 0; n.Add(n, unit) {
+			if !yield(new(big.Int).Set(n)) {
+				return
+			}
+		}
+	}
+}
+
+// spacing implements densePattern. Round amounts are a major unit apart.
+func (RoundPattern) spacing(decimals int) int64 { return pow10(decimals) }
+
+// Matches implements NumberPattern
+func (RoundPattern) Matches(formatted string) bool {
+	i := strings.LastIndexAny(formatted, ".,")
+	return i < 0 || strings.Trim(formatted[i+1:], "0") == ""
+}
+
+// ReversedPattern matches fills where the litres read as the cost reversed,
+// like 43.21 litres for £12.34
+type ReversedPattern struct{}
+
+// Name implements NumberPattern
+func (ReversedPattern) Name() string { return "reversed" }
+
+// Candidates implements NumberPattern. Any cost could pair with its reverse,
+// so every amount in the range is a candidate.
+func (ReversedPattern) Candidates(lo, hi, decimals int) []int {
+	results := make([]int, 0, max(hi-lo+1, 0))
+	for n := lo; n <= hi; n++ {
+		results = append(results, n)
+	}
+	return results
+}
+
+// CandidatesBig implements BigNumberPattern, yielding every amount one at a
+// time
+func (ReversedPattern) CandidatesBig(lo, hi *big.Int, decimals int) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		for n := new(big.Int).Set(lo); n.Cmp(hi) <= 0; n.Add(n, big.NewInt(1)) {
+			if !yield(new(big.Int).Set(n)) {
+				return
+			}
+		}
+	}
+}
+
+// spacing implements densePattern. Every amount is a candidate.
+func (ReversedPattern) spacing(decimals int) int64 { return 1 }
+
+// Matches implements NumberPattern
+func (ReversedPattern) Matches(formatted string) bool { return true }
+
+// MatchesPair implements PairedPattern
+func (ReversedPattern) MatchesPair(cost, litres string) bool {
+	return digitsOnly(litres) == reverse(digitsOnly(cost))
+}
+
+// patternNames lists the built-in patterns in the order they are offered
+var patternNames = []string{"palindrome", "repdigit", "ascending", "descending", "round", "reversed"}
+
+// ParsePattern returns the built-in pattern with the given name, defaulting
+// to palindromes under mode
+func ParsePattern(name string, mode PalindromeMode) (NumberPattern, error) {
+	return ParsePatternInBase(name, mode, 10)
+}
+
+// ParsePatternInBase is ParsePattern for palindromes in base. Only the
+// palindrome pattern can be read in bases other than ten.
+func ParsePatternInBase(name string, mode PalindromeMode, base int) (NumberPattern, error) {
+	if base == 0 {
+		base = 10
+	}
+	if err := validateBase(base); err != nil {
+		return nil, err
+	}
+
+	pattern, err := parseBase10Pattern(name, mode)
+	if err != nil || base == 10 {
+		return pattern, err
+	}
+	pal, ok := pattern.(PalindromePattern)
+	if !ok {
+		return nil, fmt.Errorf("the %s pattern only works in base 10", pattern.Name())
+	}
+	pal.Base = base
+	return pal, nil
+}
+
+// parseBase10Pattern returns the built-in pattern with the given name
+func parseBase10Pattern(name string, mode PalindromeMode) (NumberPattern, error) {
+	switch strings.ToLower(name) {
+	case "", "palindrome":
+		return PalindromePattern{Mode: mode}, nil
+	case "repdigit":
+		return RepdigitPattern{}, nil
+	case "ascending":
+		return RunPattern{}, nil
+	case "descending":
+		return RunPattern{Descending: true}, nil
+	case "round":
+		return RoundPattern{}, nil
+	case "reversed":
+		return ReversedPattern{}, nil
+	}
+	return nil, fmt.Errorf("unknown pattern %q (want %s)", name, strings.Join(patternNames, ", "))
+}
+
+// litresPattern returns the pattern a decimal litre reading is tested
+// against. Pumps print no currency symbol next to litres, and show them in
+// base ten, so symbol and other base palindromes read the litres literally.
+func litresPattern(p NumberPattern) NumberPattern {
+	if pal, ok := p.(PalindromePattern); ok && (pal.Mode == PalindromeSymbol || pal.base() != 10) {
+		return PalindromePattern{Mode: PalindromeLiteral}
+	}
+	return p
+}
+
+// Tank describes the vehicle being filled, in the search's volume unit. The
+// zero value is no tank at all.
+type Tank struct {
+	Capacity float64 `json:"capacity"`          // 0 if unknown, leaving no upper limit
+	Level    float64 `json:"level,omitempty"`   // fuel already in the tank
+	MinFill  float64 `json:"minFill,omitempty"` // smallest fill worth stopping for
+}
+
+// ParseTankLevel parses the fuel in a tank given as a volume (20), a
+// fraction (1/4) or a percentage (25%) of capacity
+func ParseTankLevel(s string, capacity float64) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	var fraction float64
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid tank level %q", s)
+		}
+		fraction = f / 100
+	} else if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err1 := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		d, err2 := strconv.ParseFloat(strings.TrimSpace(den), 64)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0, fmt.Errorf("invalid tank level %q", s)
+		}
+		fraction = n / d
+	} else {
+		level, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid tank level %q (want a volume, a fraction like 1/4 or a percentage)", s)
+		}
+		return level, nil
+	}
+
+	if capacity <= 0 {
+		return 0, fmt.Errorf("tank level %q needs the tank's capacity", s)
+	}
+	return fraction * capacity, nil
+}
+
+// UnmarshalJSON reads the level as a volume, or as a string ParseTankLevel
+// understands
+func (t *Tank) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Capacity float64         `json:"capacity"`
+		Level    json.RawMessage `json:"level"`
+		MinFill  float64         `json:"minFill"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*t = Tank{Capacity: aux.Capacity, MinFill: aux.MinFill}
+	if len(aux.Level) == 0 || string(aux.Level) == "null" {
+		return nil
+	}
+	var level string
+	if err := json.Unmarshal(aux.Level, &level); err != nil {
+		return json.Unmarshal(aux.Level, &t.Level)
+	}
+	var err error
+	t.Level, err = ParseTankLevel(level, t.Capacity)
+	return err
+}
+
+// Validate checks that the tank can take a fill
+func (t Tank) Validate() error {
+	for _, v := range []float64{t.Capacity, t.Level, t.MinFill} {
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("tank capacity, level and minimum fill must be finite, got %g", v)
+		}
+	}
+	if t.Capacity < 0 || t.Level < 0 || t.MinFill < 0 {
+		return fmt.Errorf("tank capacity, level and minimum fill must not be negative")
+	}
+	if t.Capacity > 0 && t.Level > t.Capacity {
+		return fmt.Errorf("tank level %g is more than its capacity %g", t.Level, t.Capacity)
+	}
+	if t.MinFill > t.Space() {
+		return fmt.Errorf("tank only has room for %g, less than the minimum fill %g", t.Space(), t.MinFill)
+	}
+	return nil
+}
+
+// Space returns how much fuel fits in the tank, or +Inf if its capacity is
+// unknown
+func (t Tank) Space() float64 {
+	if t.Capacity <= 0 {
+		return math.Inf(1)
+	}
+	return t.Capacity - t.Level
+}
+
+// Budget limits what a fill may cost, in major currency units like pounds.
+// A zero Min or Max leaves that end open.
+type Budget struct {
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+}
+
+// Validate checks that some cost fits the budget
+func (b Budget) Validate() error {
+	for _, v := range []float64{b.Min, b.Max} {
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("budget must be finite, got %g", v)
+		}
+	}
+	if b.Min < 0 || b.Max < 0 {
+		return fmt.Errorf("budget must not be negative")
+	}
+	if b.Max > 0 && b.Min > b.Max {
+		return fmt.Errorf("minimum spend %g is more than the maximum %g", b.Min, b.Max)
+	}
+	return nil
+}
+
+// units returns the budget in display cost units, scale to a major unit:
+// the cheapest and dearest costs within it, or nil for an open end
+func (b Budget) units(scale int64) (lo, hi *big.Int) {
+	if b.Min > 0 {
+		lo = RoundUp.round(new(big.Rat).Mul(exactDecimal(b.Min), big.NewRat(scale, 1)))
+	}
+	if b.Max > 0 {
+		hi = RoundDown.round(new(big.Rat).Mul(exactDecimal(b.Max), big.NewRat(scale, 1)))
+	}
+	return lo, hi
+}
+
+// Discount is what a forecourt takes off the pump total on the receipt,
+// like 5p a litre off, or £2 off when spending £40 or more. The parts add up,
+// and the zero value is no discount.
+type Discount struct {
+	PerUnit   float64 `json:"perUnit,omitempty"`   // minor currency units off per displayed volume unit, like 5 for 5p a litre
+	Percent   float64 `json:"percent,omitempty"`   // percentage off the pump total
+	Fixed     float64 `json:"fixed,omitempty"`     // major currency units off, like 2 for £2
+	Threshold float64 `json:"threshold,omitempty"` // pump total, in major units, the discount needs
+}
+
+// Validate checks that the discount takes something sensible off
+func (d Discount) Validate() error {
+	for _, v := range []float64{d.PerUnit, d.Percent, d.Fixed, d.Threshold} {
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("discount must be finite, got %g", v)
+		}
+	}
+	if d.PerUnit < 0 || d.Percent < 0 || d.Fixed < 0 || d.Threshold < 0 {
+		return fmt.Errorf("discount must not be negative")
+	}
+	if d.Percent >= 100 {
+		return fmt.Errorf("percentage discount must be less than 100, got %g", d.Percent)
+	}
+	return nil
+}
+
+// Extra is a shop item bought on the same receipt as the fuel, like a car
+// wash or a coffee
+type Extra struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"` // major currency units, like 6.50 for £6.50
+}
+
+// ParseExtra parses an item written name=price, like wash=6.50
+func ParseExtra(s string) (Extra, error) {
+	name, price, ok := strings.Cut(s, "=")
+	if !ok {
+		return Extra{}, fmt.Errorf("invalid item %q (want name=price, like wash=6.50)", s)
+	}
+	extra := Extra{Name: strings.TrimSpace(name)}
+	var err error
+	if extra.Price, err = strconv.ParseFloat(strings.TrimSpace(price), 64); err != nil {
+		return Extra{}, fmt.Errorf("invalid price in item %q", s)
+	}
+	return extra, extra.Validate()
+}
+
+// String writes the item the way ParseExtra reads it
+func (e Extra) String() string {
+	return e.Name + "=" + strconv.FormatFloat(e.Price, 'f', -1, 64)
+}
+
+// Validate checks that the item has a name and a price
+func (e Extra) Validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("item needs a name")
+	}
+	if e.Price <= 0 || math.IsInf(e.Price, 0) || math.IsNaN(e.Price) {
+		return fmt.Errorf("item %q needs a positive price, got %g", e.Name, e.Price)
+	}
+	return nil
+}
+
+// ChargingFees are the charges an EV charging session adds to the energy,
+// in major currency units. The zero value is no fees.
+type ChargingFees struct {
+	Session float64 `json:"session,omitempty"` // connection or session fee, like 0.35
+	Idle    float64 `json:"idle,omitempty"`    // idle or overstay fees for staying plugged in
+}
+
+// Validate checks that the fees are not negative
+func (f ChargingFees) Validate() error {
+	for _, fee := range []float64{f.Session, f.Idle} {
+		if fee < 0 || math.IsInf(fee, 0) || math.IsNaN(fee) {
+			return fmt.Errorf("charging fees must not be negative, got %g", fee)
+		}
+	}
+	return nil
+}
+
+// FillMode says what is being bought: fuel by volume, or an EV charging
+// session by energy
+type FillMode string
+
+const (
+	// FillFuel buys fuel, in litres unless another unit is given
+	FillFuel FillMode = "fuel"
+	// FillEV buys electricity in kWh, and can have charging fees
+	FillEV FillMode = "ev"
+)
+
+// ParseFillMode parses a fill mode name, defaulting to fuel
+func ParseFillMode(s string) (FillMode, error) {
+	switch strings.ToLower(s) {
+	case "", string(FillFuel):
+		return FillFuel, nil
+	case string(FillEV):
+		return FillEV, nil
+	}
+	return "", fmt.Errorf("unknown mode %q (want fuel or ev)", s)
+}
+
+// Unit resolves the volume unit code given alongside the mode: fuel
+// defaults to litres and EV to kWh, and EV needs an energy unit
+func (m FillMode) Unit(code string) (VolumeUnit, error) {
+	if code == "" && m == FillEV {
+		return KilowattHours, nil
+	}
+	unit, err := ParseVolumeUnit(code)
+	if err != nil {
+		return unit, err
+	}
+	if m == FillEV && !unit.Energy {
+		return VolumeUnit{}, fmt.Errorf("EV mode measures energy, not %s", unit.Plural)
+	}
+	return unit, nil
+}
+
+// MatchTarget says which of the total and the volume have to match the
+// search's pattern
+type MatchTarget string
+
+const (
+	// MatchTotal finds totals that match, alongside whole or matching
+	// volumes
+	MatchTotal MatchTarget = "total"
+	// MatchVolume finds volumes that match, whatever they cost
+	MatchVolume MatchTarget = "volume"
+	// MatchBoth finds totals that match alongside volumes that match too
+	MatchBoth MatchTarget = "both"
+)
+
+// ParseMatchTarget parses a match target name, defaulting to total
+func ParseMatchTarget(s string) (MatchTarget, error) {
+	for _, target := range []MatchTarget{MatchTotal, MatchVolume, MatchBoth} {
+		if strings.EqualFold(s, string(target)) {
+			return target, nil
+		}
+	}
+	if s == "" {
+		return MatchTotal, nil
+	}
+	return "", fmt.Errorf("unknown match %q (want total, volume or both)", s)
+}
+
+// VAT is the tax included in a receipt's total, which UK receipts print as
+// separate net and VAT lines
+type VAT struct {
+	Rate     float64      `json:"rate"`               // percent, like 20 for UK fuel
+	Rounding RoundingRule `json:"rounding,omitempty"` // how the VAT rounds to the penny, half-up unless given
+}
+
+// Validate checks that the rate is a percentage and the rounding is known
+func (v VAT) Validate() error {
+	if v.Rate < 0 || v.Rate > 100 || math.IsNaN(v.Rate) {
+		return fmt.Errorf("VAT rate must be between 0 and 100%%, got %g", v.Rate)
+	}
+	if _, err := ParseRoundingRule(string(v.Rounding)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// split divides a gross total in cost units into its net and VAT lines the
+// way HMRC works it out from a VAT-inclusive price: VAT is the gross times
+// rate/(100+rate), 1/6 at 20%, rounded to the penny, and net is the rest
+func (v VAT) split(gross *big.Int) (net, vat *big.Int) {
+	rule, _ := ParseRoundingRule(string(v.Rounding))
+	rate := exactDecimal(v.Rate)
+	fraction := new(big.Rat).Quo(rate, new(big.Rat).Add(rate, big.NewRat(100, 1)))
+	vat = rule.round(fraction.Mul(fraction, new(big.Rat).SetInt(gross)))
+	return new(big.Int).Sub(gross, vat), vat
+}
+
+// extrasFlag collects -extra items from the command line
+type extrasFlag []Extra
+
+func (f *extrasFlag) String() string {
+	items := make([]string, len(*f))
+	for i, extra := range *f {
+		items[i] = extra.String()
+	}
+	return strings.Join(items, ",")
+}
+
+func (f *extrasFlag) Set(s string) error {
+	extra, err := ParseExtra(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, extra)
+	return nil
+}
+
+// Vehicle is a saved vehicle profile, so the tank and pump don't have to be
+// described again for every search
+type Vehicle struct {
+	Name        string     `json:"name"`
+	Capacity    float64    `json:"capacity"`              // tank capacity, in Unit
+	FuelType    string     `json:"fuelType,omitempty"`    // petrol, diesel, ...; a label only
+	Unit        string     `json:"unit,omitempty"`        // volume unit code, litres if empty
+	TypicalFill float64    `json:"typicalFill,omitempty"` // usual fill, searched up to instead of Capacity
+	Pump        *PumpModel `json:"pump,omitempty"`        // the pump it's usually filled from
+}
+
+// Validate checks that the profile describes a vehicle we can search for
+func (v Vehicle) Validate() error {
+	if strings.TrimSpace(v.Name) == "" {
+		return fmt.Errorf("vehicle needs a name")
+	}
+	if v.Capacity <= 0 {
+		return fmt.Errorf("vehicle %q needs a tank capacity", v.Name)
+	}
+	if v.TypicalFill < 0 || v.TypicalFill > v.Capacity {
+		return fmt.Errorf("vehicle %q typical fill %g must be between 0 and its capacity %g", v.Name, v.TypicalFill, v.Capacity)
+	}
+	if _, err := ParseVolumeUnit(v.Unit); err != nil {
+		return err
+	}
+	if v.Pump != nil {
+		return v.Pump.Validate()
+	}
+	return nil
+}
+
+// MaxVolume returns how far to search for the vehicle: its typical fill if
+// known, or else a full tank, rounded up to a whole unit
+func (v Vehicle) MaxVolume() int {
+	if v.TypicalFill > 0 {
+		return int(math.Ceil(v.TypicalFill))
+	}
+	return int(math.Ceil(v.Capacity))
+}
+
+// String describes the vehicle in one line, like "van (diesel, 80 L)"
+func (v Vehicle) String() string {
+	details := []string{fmt.Sprintf("%g %s", v.Capacity, volumeUnitByCode(v.Unit).Symbol)}
+	if v.FuelType != "" {
+		details = slices.Insert(details, 0, v.FuelType)
+	}
+	if v.TypicalFill > 0 {
+		details = append(details, fmt.Sprintf("usually %g", v.TypicalFill))
+	}
+	return fmt.Sprintf("%s (%s)", v.Name, strings.Join(details, ", "))
+}
+
+// Garage is the set of saved vehicle profiles
+type Garage struct {
+	Vehicles []Vehicle `json:"vehicles"`
+}
+
+// DefaultGaragePath returns where vehicle profiles are saved: vehicles.json
+// in palindromic-fuel's directory under the user's config directory
+func DefaultGaragePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "palindromic-fuel", "vehicles.json"), nil
+}
+
+// LoadGarage reads the vehicle profiles saved at path. A missing file is an
+// empty garage.
+func LoadGarage(path string) (*Garage, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Garage{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var g Garage
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("reading vehicles from %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+// Save writes the vehicle profiles to path, creating its directory if needed
+func (g *Garage) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write a temporary file first so a failed save can't lose the garage
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// index returns the position of the named vehicle, ignoring case, or -1
+func (g *Garage) index(name string) int {
+	return slices.IndexFunc(g.Vehicles, func(v Vehicle) bool {
+		return strings.EqualFold(v.Name, strings.TrimSpace(name))
+	})
+}
+
+// Vehicle returns the named vehicle, ignoring case
+func (g *Garage) Vehicle(name string) (Vehicle, error) {
+	if i := g.index(name); i >= 0 {
+		return g.Vehicles[i], nil
+	}
+	return Vehicle{}, fmt.Errorf("no vehicle called %q", name)
+}
+
+// Add saves a vehicle profile, replacing any with the same name. It reports
+// whether a profile was replaced.
+func (g *Garage) Add(v Vehicle) (bool, error) {
+	v.Name = strings.TrimSpace(v.Name)
+	if err := v.Validate(); err != nil {
+		return false, err
+	}
+	if i := g.index(v.Name); i >= 0 {
+		g.Vehicles[i] = v
+		return true, nil
+	}
+	g.Vehicles = append(g.Vehicles, v)
+	return false, nil
+}
+
+// Remove deletes the named vehicle profile
+func (g *Garage) Remove(name string) error {
+	i := g.index(name)
+	if i < 0 {
+		return fmt.Errorf("no vehicle called %q", name)
+	}
+	g.Vehicles = slices.Delete(g.Vehicles, i, i+1)
+	return nil
+}
+
+// loadDefaultGarage reads the vehicle profiles from DefaultGaragePath
+func loadDefaultGarage() (*Garage, error) {
+	path, err := DefaultGaragePath()
+	if err != nil {
+		return nil, err
+	}
+	return LoadGarage(path)
+}
+
+// Option customises a palindrome search
+type Option func(*options)
+
+// options holds the optional settings shared by the search functions
+type options struct {
+	mode        PalindromeMode
+	pattern     NumberPattern
+	pump        PumpModel
+	currency    Currency
+	unit        VolumeUnit
+	minWindowMl float64
+	score       ScoreModel
+	minScore    float64
+	tank        Tank
+	budget      Budget
+	discount    Discount
+	extras      []Extra
+	fees        ChargingFees
+	vat         VAT
+	match       MatchTarget
+}
+
+// WithPalindromeMode selects which palindrome definition costs must meet
+func WithPalindromeMode(mode PalindromeMode) Option {
+	return func(o *options) {
+		o.mode = mode
+	}
+}
+
+// WithPattern searches for amounts matching pattern instead of palindromes
+func WithPattern(pattern NumberPattern) Option {
+	return func(o *options) {
+		o.pattern = pattern
+	}
+}
+
+// WithPumpModel selects how the pump rounds the litres and cost it displays
+func WithPumpModel(pump PumpModel) Option {
+	return func(o *options) {
+		o.pump = pump
+	}
+}
+
+// WithCurrency prices and formats costs in currency c instead of pounds.
+// Prices per litre are then given in its minor unit.
+func WithCurrency(c Currency) Option {
+	return func(o *options) {
+		o.currency = c
+	}
+}
+
+// WithVolumeUnit meters fuel in unit instead of litres. Prices, tolerances
+// and maximum volumes are then per unit, and results report volumes in it.
+func WithVolumeUnit(unit VolumeUnit) Option {
+	return func(o *options) {
+		o.unit = unit
+	}
+}
+
+// WithMinWindow drops results whose stop window is narrower than minMl
+// millilitres, leaving only targets a human can hit with the trigger
+func WithMinWindow(minMl float64) Option {
+	return func(o *options) {
+		o.minWindowMl = minMl
+	}
+}
+
+// WithScoreModel scores results with model instead of DefaultScoreModel
+func WithScoreModel(model ScoreModel) Option {
+	return func(o *options) {
+		o.score = model
+	}
+}
+
+// WithMinScore drops results scoring less than minScore
+func WithMinScore(minScore float64) Option {
+	return func(o *options) {
+		o.minScore = minScore
+	}
+}
+
+// WithTank only finds fills that fit in tank and are at least its minimum
+// fill, and reports the tank level after each
+func WithTank(tank Tank) Option {
+	return func(o *options) {
+		o.tank = tank
+	}
+}
+
+// WithDiscount finds fills whose receipt total, after discount, matches the
+// pattern, rather than the total on the pump
+func WithDiscount(discount Discount) Option {
+	return func(o *options) {
+		o.discount = discount
+	}
+}
+
+// WithExtras adds shop items to the fuel on the receipt, so that the grand
+// total has to match the pattern
+func WithExtras(extras ...Extra) Option {
+	return func(o *options) {
+		o.extras = extras
+	}
+}
+
+// WithChargingFees adds an EV charging session's fees to the energy on the
+// receipt. They need an energy unit like KilowattHours.
+func WithChargingFees(fees ChargingFees) Option {
+	return func(o *options) {
+		o.fees = fees
+	}
+}
+
+// WithMatch selects whether the total, the volume or both have to match
+func WithMatch(target MatchTarget) Option {
+	return func(o *options) {
+		o.match = target
+	}
+}
+
+// WithVAT works out the net and VAT lines of each receipt, flagging those
+// that match the pattern too. A zero rate leaves them out.
+func WithVAT(vat VAT) Option {
+	return func(o *options) {
+		o.vat = vat
+	}
+}
+
+// WithBudget only finds costs from budget.Min to budget.Max
+func WithBudget(budget Budget) Option {
+	return func(o *options) {
+		o.budget = budget
+	}
+}
+
+// search holds the exact inputs shared by every candidate cost of one search
+type search struct {
+	priceText   Price
+	price       *big.Rat // minor currency units per volume unit
+	tolerance   *big.Rat // volume units
+	costPerUnit *big.Rat // displayed cost units per volume unit
+	costScale   int64    // cost units per major currency unit
+	volumeScale int64    // displayed volume steps per volume unit
+	minSpend    *big.Int // cheapest cost in the budget, in cost units; nil if open
+	maxSpend    *big.Int // dearest cost in the budget, in cost units; nil if open
+	perUnitOff  *big.Rat // discount in cost units per displayed volume unit
+	percentOff  *big.Rat // discount as a fraction of the pump total
+	kept        *big.Rat // fraction of the pump total left after percentOff and perUnitOff
+	fixedOff    *big.Int // discount in cost units
+	discountMin *big.Int // smallest pump total, in cost units, that gets the discount
+	itemUnits   *big.Int // extras in cost units
+	feeUnits    *big.Int // charging fees in cost units
+	addedUnits  *big.Int // extras and fees, added to the fuel on the receipt
+	options
+}
+
+// newSearch converts the arguments of the public search functions into
+// exact rationals, reporting an error if they don't describe a search
+func newSearch(price Price, tolerance float64, opts []Option) (*search, error) {
+	s := &search{options: options{mode: PalindromeLiteral, pump: DefaultPumpModel, currency: GBP, unit: Litres, score: DefaultScoreModel, match: MatchTotal}}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	if err := s.pump.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.currency.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.unit.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.tank.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.budget.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.discount.Validate(); err != nil {
+		return nil, err
+	}
+	for _, extra := range s.extras {
+		if err := extra.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.vat.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.fees.Validate(); err != nil {
+		return nil, err
+	}
+	if s.fees != (ChargingFees{}) && !s.unit.Energy {
+		return nil, fmt.Errorf("charging fees need an energy unit like kwh, not %s", s.unit.Plural)
+	}
+	if _, err := ParseMatchTarget(string(s.match)); err != nil {
+		return nil, err
+	}
+	if _, ok := s.pattern.(PairedPattern); ok && s.match == MatchVolume {
+		return nil, fmt.Errorf("the %s pattern pairs the total with the volume, so it can't match the volume alone", s.pattern.Name())
+	}
+	if s.pump.VolumeDecimals == UnitVolumeDecimals {
+		s.pump.VolumeDecimals = s.unit.Decimals
+	}
+	if s.pattern == nil {
+		s.pattern = PalindromePattern{Mode: s.mode}
+	}
+	if pal, ok := s.pattern.(PalindromePattern); ok {
+		if err := pal.Validate(); err != nil {
+			return nil, err
+		}
+		if pal.Currency.Code == "" {
+			pal.Currency = s.currency
+			s.pattern = pal
+		}
+	}
+
+	s.priceText = price
+	s.price = price.Rat()
+	if s.price == nil || s.price.Sign() <= 0 {
+		return nil, fmt.Errorf("price must be a positive number, got %q", price)
+	}
+
+	s.tolerance = exactDecimal(math.Max(tolerance, 0))
+	if s.tolerance == nil {
+		return nil, fmt.Errorf("tolerance must be a number, got %v", tolerance)
+	}
+
+	// Costs are displayed in minor units, the unit prices are quoted in
+	s.costScale = pow10(s.currency.MinorUnits)
+	s.volumeScale = pow10(s.pump.VolumeDecimals)
+	s.costPerUnit = s.price
+	s.minSpend, s.maxSpend = s.budget.units(s.costScale)
+
+	scale := big.NewRat(s.costScale, 1)
+	s.perUnitOff = exactDecimal(s.discount.PerUnit)
+	s.percentOff = new(big.Rat).Quo(exactDecimal(s.discount.Percent), big.NewRat(100, 1))
+	s.fixedOff = RoundHalfUp.round(new(big.Rat).Mul(exactDecimal(s.discount.Fixed), scale))
+	s.discountMin = RoundUp.round(new(big.Rat).Mul(exactDecimal(s.discount.Threshold), scale))
+	s.itemUnits = new(big.Int)
+	for _, extra := range s.extras {
+		s.itemUnits.Add(s.itemUnits, RoundHalfUp.round(new(big.Rat).Mul(exactDecimal(extra.Price), scale)))
+	}
+	s.feeUnits = new(big.Int)
+	for _, fee := range []float64{s.fees.Session, s.fees.Idle} {
+		s.feeUnits.Add(s.feeUnits, RoundHalfUp.round(new(big.Rat).Mul(exactDecimal(fee), scale)))
+	}
+	s.addedUnits = new(big.Int).Add(s.itemUnits, s.feeUnits)
+	if s.perUnitOff.Cmp(s.price) >= 0 {
+		return nil, fmt.Errorf("discount of %g per %s is no less than the price %s", s.discount.PerUnit, s.unit.Singular, price)
+	}
+	s.kept = new(big.Rat).Sub(big.NewRat(1, 1), s.percentOff)
+	if s.kept.Sub(s.kept, new(big.Rat).Quo(s.perUnitOff, s.costPerUnit)).Sign() <= 0 {
+		return nil, fmt.Errorf("discount of %g%% and %g per %s takes off the whole price %s", s.discount.Percent, s.discount.PerUnit, s.unit.Singular, price)
+	}
+
+	return s, nil
+}
+
+// ValidateSearch reports why a search for fills up to maxLitres at price
+// can't run, or nil if it can. The search functions quietly return nothing
+// for the same inputs.
+func ValidateSearch(price Price, maxLitres int, tolerance float64, opts ...Option) error {
+	s, err := newSearch(price, tolerance, opts)
+	if err != nil {
+		return err
+	}
+	return s.validateRange(maxLitres)
+}
+
+// validateRange checks that the costs of fills up to maxLitres can be
+// generated by the search's pattern
+func (s *search) validateRange(maxLitres int) error {
+	if maxLitres < 1 {
+		return fmt.Errorf("maximum volume must be at least 1 %s, got %d", s.unit.Singular, maxLitres)
+	}
+	lo, hi := s.receiptRange(maxLitres)
+	if s.minSpend != nil && s.minSpend.Cmp(hi) > 0 {
+		return fmt.Errorf("%d %s cost at most %s, less than the minimum spend of %s",
+			maxLitres, s.unit.Plural, s.currency.withSymbol(s.formatCost(hi)), s.currency.withSymbol(s.formatCost(s.minSpend)))
+	}
+	if s.maxSpend != nil && s.maxSpend.Cmp(lo) < 0 {
+		return fmt.Errorf("even 1 %s comes to more than the maximum spend of %s", s.unit.Singular, s.currency.withSymbol(s.formatCost(s.maxSpend)))
+	}
+	if s.match == MatchVolume {
+		steps := new(big.Int).Mul(big.NewInt(int64(maxLitres)), big.NewInt(s.volumeScale))
+		if steps.Cmp(big.NewInt(maxVolumeSteps)) > 0 {
+			return fmt.Errorf("%d %s would mean checking %s volumes one at a time, more than volume matching can search (at most %d)",
+				maxLitres, s.unit.Plural, steps, maxVolumeSteps)
+		}
+	}
+	if dense, ok := s.pattern.(densePattern); ok {
+		lo, hi := s.budgetRange(lo, hi)
+		count := new(big.Int).Sub(hi, lo)
+		if count.Quo(count, big.NewInt(dense.spacing(s.currency.MinorUnits))).Cmp(big.NewInt(maxDenseCandidates)) > 0 {
+			return fmt.Errorf("%d %s would mean checking %s costs one at a time, more than the %s pattern can search (at most %d); set a spend limit to narrow it",
+				maxLitres, s.unit.Plural, count, s.pattern.Name(), maxDenseCandidates)
+		}
+	}
+	if _, ok := s.pattern.(BigNumberPattern); ok {
+		return nil
+	}
+	if _, hi = s.budgetRange(lo, hi); hi.Cmp(big.NewInt(math.MaxInt)) > 0 {
+		return fmt.Errorf("%d %s would cost up to %s, more than the %s pattern can search (at most %s)",
+			maxLitres, s.unit.Plural, s.currency.withSymbol(s.currency.formatAmountBig(hi)), s.pattern.Name(), s.currency.Format(math.MaxInt))
+	}
+	return nil
+}
+
+// formatCost formats a cost in display units as the currency writes it
+func (s *search) formatCost(units *big.Int) string {
+	return s.currency.formatAmountBig(units)
+}
+
+// formatVolume formats a displayed volume in display steps
+func (s *search) formatVolume(steps *big.Int) string {
+	return formatMinorBig(steps, s.pump.VolumeDecimals)
+}
+
+// costUnitsRange returns the display cost units bracketing fills from one
+// litre up to maxLitres, widened by one unit each way for rounding
+func (s *search) costUnitsRange(maxLitres int) (*big.Int, *big.Int) {
+	minUnits := new(big.Int).Quo(s.costPerUnit.Num(), s.costPerUnit.Denom())
+	maxCost := new(big.Rat).Mul(s.costPerUnit, big.NewRat(int64(maxLitres), 1))
+	maxUnits := new(big.Int).Quo(maxCost.Num(), maxCost.Denom())
+	return minUnits.Sub(minUnits, big.NewInt(1)), maxUnits.Add(maxUnits, big.NewInt(1))
+}
+
+// adjustsReceipt reports whether the receipt total can differ from the
+// pump total, because of a discount, extras or fees
+func (s *search) adjustsReceipt() bool {
+	return s.discount != (Discount{}) || s.addedUnits.Sign() > 0
+}
+
+// receiptRange returns the receipt totals, in cost units, bracketing fills
+// from one litre up to maxLitres. A discount can take any fill down to
+// nothing, so with one the range starts at the extras and fees alone.
+func (s *search) receiptRange(maxLitres int) (*big.Int, *big.Int) {
+	lo, hi := s.costUnitsRange(maxLitres)
+	if s.discount != (Discount{}) {
+		lo.SetInt64(0)
+	}
+	return lo.Add(lo, s.addedUnits), hi.Add(hi, s.addedUnits)
+}
+
+// budgetRange narrows a range of cost units to the search's budget
+func (s *search) budgetRange(minUnits, maxUnits *big.Int) (*big.Int, *big.Int) {
+	if s.minSpend != nil && s.minSpend.Cmp(minUnits) > 0 {
+		minUnits = s.minSpend
+	}
+	if s.maxSpend != nil && s.maxSpend.Cmp(maxUnits) < 0 {
+		maxUnits = s.maxSpend
+	}
+	return minUnits, maxUnits
+}
+
+// receipt returns the receipt total, in cost units, for a fill of volume
+// that the pump totals at units: the pump total less any discount, plus any
+// extras and fees
+func (s *search) receipt(units *big.Int, volume *big.Rat) *big.Int {
+	return new(big.Int).Add(s.fuelReceipt(units, volume), s.addedUnits)
+}
+
+// fuelReceipt returns what the fuel comes to on the receipt, in cost units:
+// the pump total less any discount
+func (s *search) fuelReceipt(units *big.Int, volume *big.Rat) *big.Int {
+	if s.discount == (Discount{}) || units.Cmp(s.discountMin) < 0 {
+		return units
+	}
+
+	off := new(big.Rat).Mul(s.perUnitOff, volume)
+	off.Add(off, new(big.Rat).Mul(s.percentOff, new(big.Rat).SetInt(units)))
+	total := new(big.Int).Sub(units, RoundHalfUp.round(off))
+	total.Sub(total, s.fixedOff)
+	if total.Sign() < 0 {
+		total.SetInt64(0)
+	}
+	return total
+}
+
+// pumpTotals returns the pump totals, in cost units and ascending order,
+// that could come to receipt after the search's discount, extras and fees.
+// Without a discount that is just receipt less those; with one it is
+// that too if it is too little for the discount, and the few totals around
+// the discounted price of the fuel. evaluate checks which of them really do.
+func (s *search) pumpTotals(receipt *big.Int) []*big.Int {
+	fuel := new(big.Int).Sub(receipt, s.addedUnits)
+	if fuel.Sign() < 1 {
+		return nil
+	}
+	if s.discount == (Discount{}) {
+		return []*big.Int{fuel}
+	}
+
+	var totals []*big.Int
+	if fuel.Cmp(s.discountMin) < 0 {
+		totals = append(totals, fuel)
+	}
+
+	// fuel ≈ pump × kept - fixed
+	estimate := new(big.Rat).SetInt(new(big.Int).Add(fuel, s.fixedOff))
+	estimate.Quo(estimate, s.kept)
+
+	// Rounding the discount moves the receipt by up to a unit, which is
+	// 1/kept units of pump total, and each receipt comes from about as many
+	spread := new(big.Int).Add(RoundUp.round(new(big.Rat).Inv(s.kept)), big.NewInt(1))
+	pump := new(big.Int).Sub(RoundDown.round(estimate), spread)
+	last := new(big.Int).Add(RoundUp.round(estimate), spread)
+	for ; pump.Cmp(last) <= 0; pump = new(big.Int).Add(pump, big.NewInt(1)) {
+		if pump.Cmp(s.discountMin) >= 0 && pump.Sign() > 0 {
+			totals = append(totals, pump)
+		}
+	}
+	return totals
+}
+
+// lazyBandDigits is the longest cost, in digits, whose candidates are
+// generated up front as ints. Longer costs come from BigNumberPattern one at
+// a time, so no band holds more than about a million candidates.
+const lazyBandDigits = 12
+
+// densePattern is a BigNumberPattern whose candidates are so close together
+// that bands of lazyBandDigits are too big to generate up front, and every
+// candidate in a huge range too many to check
+type densePattern interface {
+	// spacing returns the gap between candidates, in minor units
+	spacing(decimals int) int64
+}
+
+// maxDenseCandidates is the most candidates a search with a dense pattern
+// checks. Each one is a cost to evaluate, so more would take hours.
+const maxDenseCandidates = 100_000_000
+
+// maxVolumeSteps is the most displayed volumes a search matching the volume
+// steps through. It tests every one, so more would take hours.
+const maxVolumeSteps = 100_000_000
+
+// eagerDigits returns the longest cost, in digits, whose candidates the
+// search generates up front for the pattern. Dense patterns keep each band
+// to about a million candidates.
+func eagerDigits(p NumberPattern, decimals int) int {
+	if dense, ok := p.(densePattern); ok {
+		return 6 + len(strconv.FormatInt(dense.spacing(decimals), 10)) - 1
+	}
+	return lazyBandDigits
+}
+
+// candidates yields the costs in display units within a range that match
+// the search's pattern and budget, in ascending order. The budget narrows
+// the range before anything is generated. Amounts under one major unit
+// format with a leading zero, so they are checked one by one rather than
+// generated. Larger amounts are generated in bands of equal digit length.
+func (s *search) candidates(minUnits, maxUnits *big.Int) iter.Seq[*big.Int] {
+	return s.amounts(s.budgetRange(minUnits, maxUnits))
+}
+
+// amounts yields, in ascending order, the amounts in cost units from
+// minUnits to maxUnits that match the pattern
+func (s *search) amounts(minUnits, maxUnits *big.Int) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		one := big.NewInt(1)
+		lo := new(big.Int).Set(minUnits)
+		if lo.Sign() < 1 {
+			lo.SetInt64(1)
+		}
+
+		scale := big.NewInt(s.costScale)
+		for ; lo.Cmp(maxUnits) <= 0 && lo.Cmp(scale) < 0; lo.Add(lo, one) {
+			if s.pattern.Matches(s.formatCost(lo)) && !yield(new(big.Int).Set(lo)) {
+				return
+			}
+		}
+
+		bigPattern, isBig := s.pattern.(BigNumberPattern)
+		for lo.Cmp(maxUnits) <= 0 {
+			digits := len(lo.String())
+			hi := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+			hi.Sub(hi, one)
+			if hi.Cmp(maxUnits) > 0 {
+				hi.Set(maxUnits)
+			}
+
+			var band iter.Seq[*big.Int]
+			switch {
+			case hi.IsInt64() && hi.Int64() <= math.MaxInt && (!isBig || digits <= eagerDigits(s.pattern, s.currency.MinorUnits)):
+				band = intCandidates(s.pattern.Candidates(int(lo.Int64()), int(hi.Int64()), s.currency.MinorUnits))
+			case isBig:
+				band = bigPattern.CandidatesBig(lo, hi, s.currency.MinorUnits)
+			default:
+				// Past the int path, which validateRange reports
+				return
+			}
+
+			for units := range band {
+				if s.pattern.Matches(s.formatCost(units)) && !yield(units) {
+					return
+				}
+			}
+
+			lo = hi.Add(hi, one)
+		}
+	}
+}
+
+// intCandidates yields int candidates as big integers
+func intCandidates(candidates []int) iter.Seq[*big.Int] {
+	return func(yield func(*big.Int) bool) {
+		for _, n := range candidates {
+			if !yield(big.NewInt(int64(n))) {
+				return
+			}
+		}
+	}
+}
+
+// stopWindow is the range of metered litres, from lo up to hi, over which
+// the pump displays one particular cost, and the displayed volumes that can
+// appear alongside it
+type stopWindow struct {
+	lo, hi           *big.Rat
+	minStep, maxStep *big.Int
+}
+
+// volumeStepStart returns the metered litres at which the display starts
+// showing a volume of steps
+func (s *search) volumeStepStart(steps *big.Int) *big.Rat {
+	bound, _ := s.pump.VolumeRounding.lowerBound(steps)
+	return bound.Quo(bound, big.NewRat(s.volumeScale, 1))
+}
+
+// firstStep returns the smallest displayed volume whose price the pump
+// displays as units or more
+func (s *search) firstStep(units *big.Int) *big.Int {
+	bound, inclusive := s.pump.CostRounding.lowerBound(units)
+	x := bound.Mul(bound, big.NewRat(s.volumeScale, 1))
+	x.Quo(x, s.costPerUnit)
+	step, m := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	if m.Sign() != 0 || !inclusive {
+		step.Add(step, big.NewInt(1))
+	}
+	return step
+}
+
+// window works out the stop window for a cost in display units, reporting
+// false when no metered volume makes the pump display it
+func (s *search) window(units *big.Int) (stopWindow, bool) {
+	c := units
+	next := new(big.Int).Add(units, big.NewInt(1))
+
+	if s.pump.CostBasis == CostFromDisplayed {
+		minStep := s.firstStep(c)
+		maxStep := s.firstStep(next)
+		maxStep.Sub(maxStep, big.NewInt(1))
+		if maxStep.Cmp(minStep) < 0 {
+			return stopWindow{}, false
+		}
+		return stopWindow{
+			lo:      s.volumeStepStart(minStep),
+			hi:      s.volumeStepStart(new(big.Int).Add(maxStep, big.NewInt(1))),
+			minStep: minStep,
+			maxStep: maxStep,
+		}, true
+	}
+
+	lo, _ := s.pump.CostRounding.lowerBound(c)
+	lo.Quo(lo, s.costPerUnit)
+	hi, _ := s.pump.CostRounding.lowerBound(next)
+	hi.Quo(hi, s.costPerUnit)
+
+	// Keep only displayed volumes whose metering range overlaps the window
+	scale := big.NewRat(s.volumeScale, 1)
+	minStep := s.pump.VolumeRounding.round(new(big.Rat).Mul(lo, scale))
+	maxStep := s.pump.VolumeRounding.round(new(big.Rat).Mul(hi, scale))
+	if s.volumeStepStart(new(big.Int).Add(minStep, big.NewInt(1))).Cmp(lo) <= 0 {
+		minStep.Add(minStep, big.NewInt(1))
+	}
+	if s.volumeStepStart(maxStep).Cmp(hi) >= 0 {
+		maxStep.Sub(maxStep, big.NewInt(1))
+	}
+
+	return stopWindow{lo: lo, hi: hi, minStep: minStep, maxStep: maxStep}, true
+}
+
+// wholeLitres returns the smallest whole number of litres the pump can
+// display alongside a cost. A positive tolerance also accepts a whole number
+// of litres up to that far from the exact volume the cost buys, modelling the
+// slack of a real pump trigger.
+func (s *search) wholeLitres(units *big.Int, w stopWindow) (*big.Int, bool) {
+	scale := big.NewInt(s.volumeScale)
+	step := new(big.Int).Add(w.minStep, new(big.Int).Sub(scale, big.NewInt(1)))
+	step.Quo(step, scale)
+	if new(big.Int).Mul(step, scale).Cmp(w.maxStep) <= 0 {
+		return step, true
+	}
+
+	if s.tolerance.Sign() > 0 {
+		litres := new(big.Rat).SetInt(units)
+		litres.Quo(litres, s.costPerUnit)
+		nearest := RoundHalfUp.round(litres)
+		dist := new(big.Rat).Sub(litres, new(big.Rat).SetInt(nearest))
+		if dist.Abs(dist).Cmp(s.tolerance) <= 0 {
+			return nearest, true
+		}
+	}
+
+	return nil, false
+}
+
+// newResult describes a pump total in display units, its stop window and
+// the receipt it comes to, leaving the volume to the caller. It reports
+// false if the window is too narrow.
+func (s *search) newResult(units *big.Int, w stopWindow, receipt *big.Int) (Result, bool) {
+	width := new(big.Rat).Sub(w.hi, w.lo)
+	result := Result{
+		CostPounds: s.formatCost(receipt),
+		Price:      s.priceText,
+		MinLitres:  ratFloat(w.lo),
+		MaxLitres:  ratFloat(w.hi),
+		WindowMl:   ratFloat(width.Mul(width, big.NewRat(s.unit.Nanolitres, 1000000))),
+		Pattern:    s.pattern.Name(),
+		Currency:   s.currency.Code,
+		Unit:       s.unit.Code,
+
+		PriceIsPalindrome: s.priceText.IsPalindrome(),
+	}
+	if result.WindowMl < s.minWindowMl {
+		return Result{}, false
+	}
+	if pal, ok := s.pattern.(PalindromePattern); ok && pal.base() != 10 {
+		result.Base = pal.base()
+		result.Representation = receipt.Text(result.Base)
+	}
+	if s.adjustsReceipt() {
+		result.PumpPounds = s.formatCost(units)
+		result.PumpMatches = s.pattern.Matches(result.PumpPounds)
+	}
+	if s.discount != (Discount{}) {
+		fuel := new(big.Int).Sub(receipt, s.addedUnits)
+		result.DiscountPounds = s.formatCost(fuel.Sub(units, fuel))
+	}
+	if s.itemUnits.Sign() > 0 {
+		result.ExtrasPounds = s.formatCost(s.itemUnits)
+	}
+	if s.feeUnits.Sign() > 0 {
+		result.FeesPounds = s.formatCost(s.feeUnits)
+	}
+	if s.vat.Rate > 0 {
+		net, vat := s.vat.split(receipt)
+		result.NetPounds, result.VATPounds = s.formatCost(net), s.formatCost(vat)
+		result.NetMatches = s.pattern.Matches(result.NetPounds)
+		result.VATMatches = s.pattern.Matches(result.VATPounds)
+	}
+	return result, true
+}
+
+// evaluate checks whether a pump total in display units can be printed
+// alongside a whole or palindromic decimal number of litres, for a receipt
+// that comes to the palindromic receipt total. Without a discount the two
+// totals are the same. Price and tolerance are exact, so the answer never
+// depends on floating point.
+func (s *search) evaluate(units *big.Int, w stopWindow, receipt *big.Int) (Result, bool) {
+	result, ok := s.newResult(units, w, receipt)
+	if !ok {
+		return Result{}, false
+	}
+
+	// A per litre discount depends on the litres displayed
+	paysReceipt := func(volume *big.Rat) bool {
+		return s.receipt(units, volume).Cmp(receipt) == 0
+	}
+
+	paired, isPaired := s.pattern.(PairedPattern)
+
+	if whole, ok := s.wholeLitres(units, w); ok {
+		if whole.Sign() < 1 {
+			return Result{}, false
+		}
+		wholeStr := s.formatVolume(new(big.Int).Mul(whole, big.NewInt(s.volumeScale)))
+		if (!isPaired || paired.MatchesPair(result.CostPounds, wholeStr)) && paysReceipt(new(big.Rat).SetInt(whole)) {
+			result.Litres = ratFloat(new(big.Rat).SetInt(whole))
+			result.Volume = wholeStr
+			result.LitresIsPalindrome = isPalindromeString(whole.String())
+			result.Type = "whole"
+			return s.scored(result)
+		}
+	}
+
+	// Check if any litre reading the pump can show matches the pattern too
+	_, isPalindromic := s.pattern.(PalindromePattern)
+	decimalType := s.pattern.Name() + "_decimal"
+	if isPalindromic {
+		decimalType = "palindromic_decimal"
+	}
+
+	litresPattern := litresPattern(s.pattern)
+	minStep := new(big.Int).Set(w.minStep)
+	if minStep.Cmp(big.NewInt(s.volumeScale)) < 0 {
+		minStep.SetInt64(s.volumeScale)
+	}
+	for step := minStep; step.Cmp(w.maxStep) <= 0; step.Add(step, big.NewInt(1)) {
+		litresStr := s.formatVolume(step)
+		matches := isPaired && paired.MatchesPair(result.CostPounds, litresStr) || !isPaired && litresPattern.Matches(litresStr)
+		if matches && paysReceipt(new(big.Rat).SetFrac(step, big.NewInt(s.volumeScale))) {
+			result.Litres = ratFloat(new(big.Rat).SetFrac(step, big.NewInt(s.volumeScale)))
+			result.Volume = litresStr
+			result.LitresIsPalindrome = isPalindromic || isPalindromeString(litresStr)
+			result.Type = decimalType
+			return s.scored(result)
+		}
+	}
+
+	return Result{}, false
+}
+
+// scored scores a result, reporting false if it scores too low or doesn't
+// fit the tank
+func (s *search) scored(result Result) (Result, bool) {
+	if s.tank != (Tank{}) {
+		if result.Litres < s.tank.MinFill || result.Litres > s.tank.Space() {
+			return Result{}, false
+		}
+		result.TankLevel = s.tank.Level + result.Litres
+		if s.tank.Capacity > 0 {
+			result.TankFull = result.TankLevel / s.tank.Capacity
+		}
+	}
+
+	result.Score = s.score.Score(result)
+	if result.Score < s.minScore {
+		return Result{}, false
+	}
+	return result, true
+}
+
+// FindPalindromicFuelCosts finds all palindromic fuel costs for a given price.
+// A cost counts as whole litres when the pump can display a whole number of
+// litres alongside it, or lands within tolerance litres of one when
+// tolerance is positive.
+func FindPalindromicFuelCosts(pricePerLitre float64, maxLitres int, tolerance float64, opts ...Option) []Result {
+	return FindPalindromicFuelCostsAt(PriceFromFloat(pricePerLitre), maxLitres, tolerance, opts...)
+}
+
+// FindPalindromicFuelCostsAt is FindPalindromicFuelCosts for an exact price
+func FindPalindromicFuelCostsAt(price Price, maxLitres int, tolerance float64, opts ...Option) []Result {
+	var results []Result
+	for result := range StreamPalindromicFuelCosts(context.Background(), price, maxLitres, tolerance, opts...) {
+		results = append(results, result)
+	}
+	return results
+}
+
+// StreamPalindromicFuelCosts yields the results of FindPalindromicFuelCostsAt
+// one at a time, cheapest first, so litres increase as it goes. Candidates
+// are generated one digit length at a time rather than all up front, and the
+// search stops early when ctx is cancelled or the caller stops ranging. It
+// yields nothing for inputs ValidateSearch rejects.
+func StreamPalindromicFuelCosts(ctx context.Context, price Price, maxLitres int, tolerance float64, opts ...Option) iter.Seq[Result] {
+	return func(yield func(Result) bool) {
+		s, err := newSearch(price, tolerance, opts)
+		if err != nil || s.validateRange(maxLitres) != nil {
+			return
+		}
+		// Nothing bigger than the tank has room for
+		if space := s.tank.Space(); space < float64(maxLitres) {
+			maxLitres = int(math.Ceil(space))
+		}
+
+		if s.match == MatchVolume {
+			s.streamVolumes(ctx, maxLitres, yield)
+			return
+		}
+
+		minUnits, maxUnits := s.receiptRange(maxLitres)
+		s.stream(ctx, minUnits, maxUnits, maxLitres, yield)
+	}
+}
+
+// stream yields, cheapest first, the results for receipt totals from
+// minUnits to maxUnits that the pump can reach within maxLitres
+func (s *search) stream(ctx context.Context, minUnits, maxUnits *big.Int, maxLitres int, yield func(Result) bool) {
+	maxLitresRat := big.NewRat(int64(maxLitres), 1)
+
+	for receipt := range s.candidates(minUnits, maxUnits) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		for i, units := range s.pumpTotals(receipt) {
+			w, ok := s.window(units)
+			if !ok {
+				continue
+			}
+
+			// Stop once the pump can no longer display the cost within
+			// max litres. Later receipts need bigger pump totals.
+			if w.lo.Cmp(maxLitresRat) > 0 {
+				if i == 0 {
+					return
+				}
+				break
+			}
+
+			if result, ok := s.evaluate(units, w, receipt); ok && result.Litres <= float64(maxLitres) {
+				if s.match == MatchBoth && !s.volumeMatches(result) {
+					continue
+				}
+				if !yield(result) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// volumeMatches reports whether a result's volume matches the search's
+// pattern as well as its total, counting a whole volume by its whole number
+// so that 121 litres matches as a palindrome
+func (s *search) volumeMatches(result Result) bool {
+	pattern := litresPattern(s.pattern)
+	if result.Type == "whole" {
+		return pattern.Matches(strconv.FormatFloat(result.Litres, 'f', 0, 64))
+	}
+	return pattern.Matches(result.Volume)
+}
+
+// streamVolumes yields, smallest first, the fills up to maxLitres whose
+// displayed volume matches the search's pattern, whatever they come to. A
+// reading can go with more than one total while the pump catches up, and
+// each gets its own result.
+func (s *search) streamVolumes(ctx context.Context, maxLitres int, yield func(Result) bool) {
+	pattern := litresPattern(s.pattern)
+	_, isPalindromic := s.pattern.(PalindromePattern)
+	decimalType := s.pattern.Name() + "_decimal"
+	if isPalindromic {
+		decimalType = "palindromic_decimal"
+	}
+
+	last := int64(maxLitres) * s.volumeScale
+	for n := s.volumeScale; n <= last; n++ {
+		if n%1024 == 0 && ctx.Err() != nil {
+			return
+		}
+		step := big.NewInt(n)
+		volumeStr := s.formatVolume(step)
+		whole := n%s.volumeScale == 0
+		wholeStr := strconv.FormatInt(n/s.volumeScale, 10)
+		if !pattern.Matches(volumeStr) && !(whole && pattern.Matches(wholeStr)) {
+			continue
+		}
+
+		volume := new(big.Rat).SetFrac(step, big.NewInt(s.volumeScale))
+		for units, w := range s.totalsAt(step) {
+			receipt := s.receipt(units, volume)
+			if (s.minSpend != nil && receipt.Cmp(s.minSpend) < 0) || (s.maxSpend != nil && receipt.Cmp(s.maxSpend) > 0) {
+				continue
+			}
+			result, ok := s.newResult(units, w, receipt)
+			if !ok {
+				continue
+			}
+			if !s.pattern.Matches(result.CostPounds) {
+				result.Pattern = ""
+			}
+			result.Litres = ratFloat(volume)
+			result.Volume = volumeStr
+			if whole {
+				result.LitresIsPalindrome = isPalindromeString(wholeStr)
+				result.Type = "whole"
+			} else {
+				result.LitresIsPalindrome = isPalindromic || isPalindromeString(volumeStr)
+				result.Type = decimalType
+			}
+			if result, ok := s.scored(result); ok && !yield(result) {
+				return
+			}
+		}
+	}
+}
+
+// totalsAt yields the pump totals, in cost units, that the pump can display
+// alongside a displayed volume of steps, each with the part of its stop
+// window that shows that volume
+func (s *search) totalsAt(step *big.Int) iter.Seq2[*big.Int, stopWindow] {
+	return func(yield func(*big.Int, stopWindow) bool) {
+		next := new(big.Int).Add(step, big.NewInt(1))
+		lo, hi := s.volumeStepStart(step), s.volumeStepStart(next)
+		first := s.pump.CostRounding.round(new(big.Rat).Mul(lo, s.costPerUnit))
+		last := s.pump.CostRounding.round(new(big.Rat).Mul(hi, s.costPerUnit))
+
+		for units := first; units.Cmp(last) <= 0; units = new(big.Int).Add(units, big.NewInt(1)) {
+			w, ok := s.window(units)
+			if !ok || w.minStep.Cmp(step) > 0 || w.maxStep.Cmp(step) < 0 {
+				continue
+			}
+			if w.lo.Cmp(lo) < 0 {
+				w.lo = lo
+			}
+			if w.hi.Cmp(hi) > 0 {
+				w.hi = hi
+			}
+			w.minStep, w.maxStep = step, step
+			if !yield(units, w) {
+				return
+			}
+		}
+	}
+}
+
+// Target is a stop point ahead of the pump's current reading
+type Target struct {
+	Result
+	LitresToGo float64 // how much further to fill, in the result's unit
+	CostToGo   string  // how much more the pump has to show, formatted like CostPounds
+}
+
+// NextTargetsReach is how far past the current reading, in the search's
+// volume unit, NextTargets looks for targets when there is no tank to fill
+const NextTargetsReach = 1000
+
+// DefaultNextTargets is how many targets the CLI and API show by default
+const DefaultNextTargets = 5
+
+// nextTargetsMax returns the largest fill NextTargets considers from a
+// reading of currentLitres, before any tank narrows it
+func nextTargetsMax(currentLitres float64) int {
+	return int(math.Ceil(currentLitres)) + NextTargetsReach
+}
+
+// NextTargets finds the next n stop points ahead of a fill whose display
+// has reached currentLitres, nearest first. Only totals past what the pump
+// already shows are generated. It returns nil for a search ValidateSearch
+// would reject or a negative reading.
+func NextTargets(price Price, currentLitres float64, n int, tolerance float64, opts ...Option) []Target {
+	s, err := newSearch(price, tolerance, opts)
+	current := exactDecimal(currentLitres)
+	if err != nil || current == nil || current.Sign() < 0 || n < 1 {
+		return nil
+	}
+
+	maxLitres := nextTargetsMax(currentLitres)
+	if space := s.tank.Space(); space < float64(maxLitres) {
+		maxLitres = int(math.Ceil(space))
+	}
+	if s.validateRange(maxLitres) != nil {
+		return nil
+	}
+
+	// What the pump shows now, and the receipt that would come to
+	shown := s.pump.CostRounding.round(new(big.Rat).Mul(current, s.costPerUnit))
+	minUnits, maxUnits := s.receiptRange(maxLitres)
+	// A discount can take a bigger pump total to a smaller receipt, so with
+	// one every receipt is checked
+	if receipt := s.receipt(shown, current); receipt.Cmp(minUnits) > 0 && s.discount == (Discount{}) {
+		minUnits = receipt
+	}
+
+	var targets []Target
+	yield := func(result Result) bool {
+		pumpText := result.CostPounds
+		if result.PumpPounds != "" {
+			pumpText = result.PumpPounds
+		}
+		pump, _ := new(big.Int).SetString(digitsOnly(pumpText), 10)
+
+		// A reading the pump has passed is no target, though a volume can
+		// still be ahead while the total catches up
+		if result.Litres <= currentLitres || s.match != MatchVolume && pump.Cmp(shown) <= 0 {
+			return true
+		}
+		toGo := new(big.Int).Sub(pump, shown)
+		if toGo.Sign() < 0 {
+			toGo.SetInt64(0)
+		}
+		targets = append(targets, Target{
+			Result:     result,
+			LitresToGo: ratFloat(new(big.Rat).Sub(exactDecimal(result.Litres), current)),
+			CostToGo:   s.formatCost(toGo),
+		})
+		return len(targets) < n
+	}
+
+	if s.match == MatchVolume {
+		s.streamVolumes(context.Background(), maxLitres, yield)
+	} else {
+		s.stream(context.Background(), minUnits, maxUnits, maxLitres, yield)
+	}
+	return targets
+}
+
+// litresForCost returns the volume at which the pump shows a cost in major
+// currency units, for turning a reading of the cost into one of the litres
+func litresForCost(price Price, pounds float64, currency Currency) float64 {
+	cost, perUnit := exactDecimal(pounds), price.Rat()
+	if cost == nil || perUnit == nil || perUnit.Sign() == 0 {
+		return 0
+	}
+	cost.Mul(cost, big.NewRat(pow10(currency.MinorUnits), 1))
+	return ratFloat(cost.Quo(cost, perUnit))
+}
+
+// FindNearestPalindromicCost finds the nearest palindromic cost to a target amount
+func FindNearestPalindromicCost(pricePerLitre float64, targetLitres float64, searchRadius int, tolerance float64, opts ...Option) *Result {
+	return FindNearestPalindromicCostAt(PriceFromFloat(pricePerLitre), targetLitres, searchRadius, tolerance, opts...)
+}
+
+// FindNearestPalindromicCostAt is FindNearestPalindromicCost for an exact price
+func FindNearestPalindromicCostAt(price Price, targetLitres float64, searchRadius int, tolerance float64, opts ...Option) *Result {
+	minLitres := int(math.Max(1, targetLitres-float64(searchRadius)))
+	maxLitres := int(targetLitres + float64(searchRadius))
+
+	results := FindPalindromicFuelCostsAt(price, maxLitres, tolerance, opts...)
+
+	var nearest *Result
+	minDiff := math.MaxFloat64
+
+	for i := range results {
+		if results[i].Litres < float64(minLitres) {
+			continue
+		}
+
+		diff := math.Abs(results[i].Litres - targetLitres)
+		if diff < minDiff {
+			minDiff = diff
+			nearest = &results[i]
+		}
+	}
+
+	return nearest
+}
+
+// FindPalindromicCostForTarget finds palindromic costs near a target price
+func FindPalindromicCostForTarget(pricePerLitre float64, targetPounds float64, searchRadiusPence int, tolerance float64, opts ...Option) []Result {
+	return FindPalindromicCostForTargetAt(PriceFromFloat(pricePerLitre), targetPounds, searchRadiusPence, tolerance, opts...)
+}
+
+// FindPalindromicCostForTargetAt is FindPalindromicCostForTarget for an exact
+// price
+func FindPalindromicCostForTargetAt(price Price, targetPounds float64, searchRadiusPence int, tolerance float64, opts ...Option) []Result {
+	var results []Result
+
+	s, err := newSearch(price, tolerance, opts)
+	target := exactDecimal(targetPounds)
+	if err != nil || target == nil || searchRadiusPence < 0 {
+		return results
+	}
+
+	targetUnits := RoundHalfUp.round(target.Mul(target, big.NewRat(s.costScale, 1)))
+	radius := big.NewInt(int64(searchRadiusPence))
+	minUnits := new(big.Int).Sub(targetUnits, radius)
+	maxUnits := new(big.Int).Add(targetUnits, radius)
+
+	for receipt := range s.candidates(minUnits, maxUnits) {
+		for _, units := range s.pumpTotals(receipt) {
+			w, ok := s.window(units)
+			if !ok {
+				continue
+			}
+
+			if result, ok := s.evaluate(units, w, receipt); ok {
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results
+}
+
+// FindPricesForCost finds the pump prices from minPrice to maxPrice, step
+// apart, at which a fill can come to exactly targetPounds with whole litres
+// or litres matching the search's pattern on the display. The target itself
+// needn't match. There is one result per price that works, cheapest first.
+func FindPricesForCost(targetPounds float64, minPrice, maxPrice, step float64, tolerance float64, opts ...Option) []Result {
+	prices := PriceRange{Min: PriceFromFloat(minPrice), Max: PriceFromFloat(maxPrice), Step: PriceFromFloat(step)}
+	return FindPricesForCostAt(targetPounds, prices, tolerance, opts...)
+}
+
+// FindPricesForCostAt is FindPricesForCost for an exact range of prices.
+// Prices the options don't work at are skipped.
+func FindPricesForCostAt(targetPounds float64, prices PriceRange, tolerance float64, opts ...Option) []Result {
+	var results []Result
+
+	target := exactDecimal(targetPounds)
+	if target == nil || target.Sign() <= 0 {
+		return results
+	}
+
+	for price := range prices.Prices() {
+		s, err := newSearch(price, tolerance, opts)
+		if err != nil {
+			// Options like a per litre discount can rule out some prices only
+			continue
+		}
+
+		receipt := RoundHalfUp.round(new(big.Rat).Mul(target, big.NewRat(s.costScale, 1)))
+		if lo, hi := s.budgetRange(receipt, receipt); lo.Cmp(hi) > 0 {
+			// The target is outside the budget at every price
+			return results
+		}
+
+		// One fill per price is enough
+		for _, units := range s.pumpTotals(receipt) {
+			w, ok := s.window(units)
+			if !ok {
+				continue
+			}
+
+			if result, ok := s.evaluate(units, w, receipt); ok {
+				results = append(results, result)
+				break
+			}
+		}
+	}
+
+	return results
+}
+
+// ScoreModel weighs what makes a fill satisfying. A result's score is the
+// sum of the points for each thing it has going for it.
+type ScoreModel struct {
+	DoublePalindrome  float64 `json:"doublePalindrome"`  // palindromic cost and litres
+	PalindromicLitres float64 `json:"palindromicLitres"` // palindromic litres, whatever the cost's pattern
+	PalindromicPrice  float64 `json:"palindromicPrice"`  // palindromic price per unit, like 128.821p
+	RoundLitres       float64 `json:"roundLitres"`       // a whole number of units, twice for a multiple of ten
+	WindowPerMl       float64 `json:"windowPerMl"`       // per millilitre of stop window...
+	MaxWindowMl       float64 `json:"maxWindowMl"`       // ...up to this many
+	Symmetry          float64 `json:"symmetry"`          // times the share of the litres' digits that mirror
+}
+
+// DefaultScoreModel puts double palindromes first and rewards targets that
+// are easy to hit
+var DefaultScoreModel = ScoreModel{
+	DoublePalindrome:  40,
+	PalindromicLitres: 20,
+	PalindromicPrice:  15,
+	RoundLitres:       10,
+	WindowPerMl:       1,
+	MaxWindowMl:       20,
+	Symmetry:          10,
+}
+
+// Score rates how satisfying a result is
+func (m ScoreModel) Score(result Result) float64 {
+	score := 0.0
+	if result.LitresIsPalindrome {
+		score += m.PalindromicLitres
+		if result.Pattern == "palindrome" {
+			score += m.DoublePalindrome
+		}
+	}
+	if result.Price.IsPalindrome() {
+		score += m.PalindromicPrice
+	}
+	if result.Litres == math.Floor(result.Litres) {
+		score += m.RoundLitres
+		if math.Mod(result.Litres, 10) == 0 {
+			score += m.RoundLitres
+		}
+	}
+	score += m.WindowPerMl * math.Min(result.WindowMl, m.MaxWindowMl)
+	return score + m.Symmetry*digitSymmetry(digitsOnly(formatResultVolume(result)))
+}
+
+// digitSymmetry returns the share of digit pairs, first with last and so on
+// inwards, that match: 1 for a palindrome, 0 if none do
+func digitSymmetry(digits string) float64 {
+	pairs := len(digits) / 2
+	if pairs == 0 {
+		return 1
+	}
+	matches := 0
+	for i := 0; i < pairs; i++ {
+		if digits[i] == digits[len(digits)-1-i] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(pairs)
+}
+
+// FindTriplePalindromes searches every palindromic price in a range for
+// fills up to maxLitres whose litres are palindromes too, so the price, the
+// litres and the cost on the receipt all read the same backwards. Results
+// come cheapest price first.
+func FindTriplePalindromes(ctx context.Context, prices PriceRange, maxLitres int, tolerance float64, opts ...Option) []Result {
+	var results []Result
+	for price := range prices.Prices() {
+		if !price.IsPalindrome() {
+			continue
+		}
+		for result := range StreamPalindromicFuelCosts(ctx, price, maxLitres, tolerance, opts...) {
+			if result.IsTriplePalindrome() {
+				results = append(results, result)
+			}
+		}
+	}
+	return results
+}
+
+// Split describes sharing a fill's total between several payers, in equal
+// shares or in whatever shares match
+type Split struct {
+	Ways  int  `json:"ways"`            // how many payments, from 2 to MaxSplitWays
+	Equal bool `json:"equal,omitempty"` // every payment the same
+}
+
+// MaxSplitWays is the most payments a total can be split into. Free splits
+// search combinations of payments, which grow quickly with each payer.
+const MaxSplitWays = 4
+
+// Validate checks that the split has a sensible number of payers
+func (sp Split) Validate() error {
+	if sp.Ways < 2 || sp.Ways > MaxSplitWays {
+		return fmt.Errorf("a split needs 2 to %d payments, got %d", MaxSplitWays, sp.Ways)
+	}
+	return nil
+}
+
+// SplitResult is a fill whose total can be paid in payments that all match
+// the pattern too
+type SplitResult struct {
+	Result
+	Payments []string // each payment, formatted like CostPounds, smallest first
+}
+
+// FindSplitPayments finds the fills up to maxLitres whose total matches the
+// pattern and can be paid in split.Ways payments that each match it as
+// well. Free splits use the most even payments that work. Results come
+// cheapest first, and the search stops early when ctx is cancelled.
+func FindSplitPayments(ctx context.Context, price Price, maxLitres int, tolerance float64, split Split, opts ...Option) []SplitResult {
+	s, err := newSearch(price, tolerance, opts)
+	if err != nil || split.Validate() != nil {
+		return nil
+	}
+
+	var results []SplitResult
+	var amounts []int64 // matching amounts up to the latest total
+	for result := range StreamPalindromicFuelCosts(ctx, price, maxLitres, tolerance, opts...) {
+		// Results that only match by volume have no matching total to split
+		if result.Pattern == "" {
+			continue
+		}
+		total, ok := new(big.Int).SetString(digitsOnly(result.CostPounds), 10)
+		if !ok || !total.IsInt64() {
+			continue
+		}
+
+		var payments []int64
+		if split.Equal {
+			if share := total.Int64() / int64(split.Ways); share*int64(split.Ways) == total.Int64() && s.pattern.Matches(s.formatCost(big.NewInt(share))) {
+				payments = slices.Repeat([]int64{share}, split.Ways)
+			}
+		} else {
+			from := int64(1)
+			if len(amounts) > 0 {
+				from = amounts[len(amounts)-1] + 1
+			}
+			for amount := range s.amounts(big.NewInt(from), total) {
+				amounts = append(amounts, amount.Int64())
+			}
+			payments = splitEvenly(amounts, total.Int64(), split.Ways)
+		}
+		if payments == nil {
+			continue
+		}
+
+		sr := SplitResult{Result: result}
+		for _, payment := range payments {
+			sr.Payments = append(sr.Payments, s.formatCost(big.NewInt(payment)))
+		}
+		results = append(results, sr)
+	}
+	return results
+}
+
+// splitEvenly picks ways amounts, repeats allowed, from the ascending list
+// that add up to total, keeping the gap between the largest and smallest as
+// small as it can. It returns them smallest first, or nil if none add up.
+func splitEvenly(amounts []int64, total int64, ways int) []int64 {
+	matching := make(map[int64]bool, len(amounts))
+	for _, amount := range amounts {
+		matching[amount] = true
+	}
+
+	var best []int64
+	bestSpread := int64(math.MaxInt64)
+	chosen := make([]int64, 0, ways)
+
+	// choose adds payments no smaller than amounts[from] until one is left,
+	// which has to be exactly what remains
+	var choose func(from int, remaining int64)
+	choose = func(from int, remaining int64) {
+		left := int64(ways - len(chosen))
+		if left == 1 {
+			if remaining >= chosen[len(chosen)-1] && matching[remaining] && remaining-chosen[0] < bestSpread {
+				bestSpread = remaining - chosen[0]
+				best = append(slices.Clone(chosen), remaining)
+			}
+			return
+		}
+		for i := from; i < len(amounts) && amounts[i]*left <= remaining; i++ {
+			if amounts[i]-chosen[0] >= bestSpread {
+				return
+			}
+			chosen = append(chosen, amounts[i])
+			choose(i, remaining-amounts[i])
+			chosen = chosen[:len(chosen)-1]
+		}
+	}
+
+	// Try the smallest payment from a fair share downwards, stopping once
+	// the others can't be close enough to beat the best so far
+	first, _ := slices.BinarySearch(amounts, total/int64(ways)+1)
+	for i := first - 1; i >= 0; i-- {
+		smallest := amounts[i]
+		if (total-smallest)/int64(ways-1)-smallest >= bestSpread {
+			break
+		}
+		chosen = append(chosen[:0], smallest)
+		choose(i, total-smallest)
+	}
+	return best
+}
+
+// SortOrder selects how results are ordered for display
+type SortOrder string
+
+const (
+	// SortByLitres lists results by increasing litres, as they are found
+	SortByLitres SortOrder = "litres"
+	// SortByWindow lists the most forgiving stop windows first
+	SortByWindow SortOrder = "window"
+	// SortByScore lists the most satisfying fills first
+	SortByScore SortOrder = "score"
+)
+
+// sortOrders lists the supported orders in the order they are offered
+var sortOrders = []SortOrder{SortByLitres, SortByWindow, SortByScore}
+
+// ParseSortOrder parses a sort order name, defaulting to litres
+func ParseSortOrder(s string) (SortOrder, error) {
+	if s == "" {
+		return SortByLitres, nil
+	}
+	for _, order := range sortOrders {
+		if strings.EqualFold(s, string(order)) {
+			return order, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sort order %q (want litres, window or score)", s)
+}
+
+// SortResults orders results in place, keeping ties in litre order
+func SortResults(results []Result, order SortOrder) {
+	switch order {
+	case SortByWindow:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].WindowMl > results[j].WindowMl
+		})
+	case SortByScore:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Score > results[j].Score
+		})
+	default:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Litres < results[j].Litres
+		})
+	}
+}
+
+// BatchFindPalindromicCosts processes multiple fuel prices concurrently
+func BatchFindPalindromicCosts(prices []float64, maxLitres int, tolerance float64, opts ...Option) map[float64][]Result {
+	exact := make([]Price, len(prices))
+	for i, price := range prices {
+		exact[i] = PriceFromFloat(price)
+	}
+	batch := BatchFindPalindromicCostsAt(exact, maxLitres, tolerance, opts...)
+
+	results := make(map[float64][]Result)
+	for i, price := range prices {
+		results[price] = batch[exact[i]]
+	}
+	return results
+}
+
+// BatchFindPalindromicCostsAt is BatchFindPalindromicCosts for exact prices
+func BatchFindPalindromicCostsAt(prices []Price, maxLitres int, tolerance float64, opts ...Option) map[Price][]Result {
+	results := make(map[Price][]Result)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, price := range prices {
+		wg.Add(1)
+		go func(p Price) {
+			defer wg.Done()
+			res := FindPalindromicFuelCostsAt(p, maxLitres, tolerance, opts...)
+			mu.Lock()
+			results[p] = res
+			mu.Unlock()
+		}(price)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// PriceStats summarises what a sweep found at one price
+type PriceStats struct {
+	Price   Price   `json:"price"`
+	Whole   int     `json:"whole"`   // fills of whole litres
+	Decimal int     `json:"decimal"` // fills of decimal litres
+	Double  int     `json:"double"`  // fills whose litres are palindromes too
+	Total   int     `json:"total"`
+	Best    *Result `json:"best,omitempty"`
+}
+
+// Sweep is the outcome of searching every price in a range
+type Sweep struct {
+	Prices   []PriceStats `json:"prices"`
+	Luckiest Price        `json:"luckiest,omitempty"` // cheapest price with the most results
+	Dead     []Price      `json:"dead"`               // prices with no results
+	Total    int          `json:"total"`
+	Mean     float64      `json:"mean"` // results per price
+}
+
+// betterResult reports whether a makes a better target than b: the higher
+// score, then the widest stop window
+func betterResult(a, b Result) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.WindowMl > b.WindowMl
+}
+
+// summarisePrice counts the results found at one price
+func summarisePrice(price Price, results iter.Seq[Result]) PriceStats {
+	stats := PriceStats{Price: price}
+	for result := range results {
+		stats.Total++
+		if result.Type == "whole" {
+			stats.Whole++
+		} else {
+			stats.Decimal++
+		}
+		if result.LitresIsPalindrome {
+			stats.Double++
+		}
+		if stats.Best == nil || betterResult(result, *stats.Best) {
+			stats.Best = &result
+		}
+	}
+	return stats
+}
+
+// SweepPrices searches fills up to maxLitres at every price in a range,
+// several prices at a time, and summarises what each found. It stops early
+// with ctx's error if ctx is cancelled.
+func SweepPrices(ctx context.Context, prices PriceRange, maxLitres int, tolerance float64, opts ...Option) (Sweep, error) {
+	if err := prices.Validate(); err != nil {
+		return Sweep{}, err
+	}
+	list := slices.Collect(prices.Prices())
+	// The dearest price has the widest range of costs to search
+	if err := ValidateSearch(list[len(list)-1], maxLitres, tolerance, opts...); err != nil {
+		return Sweep{}, err
+	}
+
+	sweep := Sweep{Prices: make([]PriceStats, len(list)), Dead: []Price{}}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results := StreamPalindromicFuelCosts(ctx, list[i], maxLitres, tolerance, opts...)
+				sweep.Prices[i] = summarisePrice(list[i], results)
+			}
+		}()
+	}
+	for i := range list {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return Sweep{}, err
+	}
+
+	most := 0
+	for _, stats := range sweep.Prices {
+		sweep.Total += stats.Total
+		if stats.Total == 0 {
+			sweep.Dead = append(sweep.Dead, stats.Price)
+		} else if stats.Total > most {
+			most = stats.Total
+			sweep.Luckiest = stats.Price
+		}
+	}
+	sweep.Mean = float64(sweep.Total) / float64(len(sweep.Prices))
+
+	return sweep, nil
+}
+
+// defaultTolerance is the pump tolerance, in litres, used by the CLI and web
+// server when none is given. The pump model already decides which litres
+// can be printed with each cost, so by default no extra slack is allowed.
+const defaultTolerance = 0.0
+
+// Web server types and handlers
+type CalculateRequest struct {
+	PricePerLitre float64       `json:"pricePerLitre"`
+	MaxLitres     int           `json:"maxLitres"`
+	Tolerance     *float64      `json:"tolerance,omitempty"`
+	Palindrome    string        `json:"palindrome,omitempty"`
+	Pattern       string        `json:"pattern,omitempty"`
+	Pump          *PumpModel    `json:"pump,omitempty"`
+	Sort          string        `json:"sort,omitempty"`
+	MinWindowMl   float64       `json:"minWindowMl,omitempty"`
+	MinScore      float64       `json:"minScore,omitempty"`
+	MinSpend      float64       `json:"minSpend,omitempty"`
+	MaxSpend      float64       `json:"maxSpend,omitempty"`
+	Discount      *Discount     `json:"discount,omitempty"`
+	Items         []Extra       `json:"items,omitempty"`
+	VAT           *VAT          `json:"vat,omitempty"`
+	Mode          string        `json:"mode,omitempty"`
+	Fees          *ChargingFees `json:"fees,omitempty"`
+	Match         string        `json:"match,omitempty"`
+	Tank          *Tank         `json:"tank,omitempty"`
+	Vehicle       string        `json:"vehicle,omitempty"`
+	Currency      string        `json:"currency,omitempty"`
+	Unit          string        `json:"unit,omitempty"`
+	Stream        bool          `json:"stream,omitempty"`
+	Base          int           `json:"base,omitempty"`
+
+	exactPrice Price // PricePerLitre with every digit as given, if known
+}
+
+// UnmarshalJSON keeps the exact digits of pricePerLitre alongside the float
+func (req *CalculateRequest) UnmarshalJSON(data []byte) error {
+	type plain CalculateRequest
+	var aux struct {
+		plain
+		PricePerLitre Price `json:"pricePerLitre"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*req = CalculateRequest(aux.plain)
+	req.PricePerLitre = aux.PricePerLitre.Float64()
+	req.exactPrice = aux.PricePerLitre
+	return nil
+}
+
+// Price returns the requested price exactly as given
+func (req CalculateRequest) Price() Price {
+	if req.exactPrice != "" {
+		return req.exactPrice
+	}
+	return PriceFromFloat(req.PricePerLitre)
+}
+
+// tolerance returns the requested pump tolerance or the default
+func (req CalculateRequest) tolerance() float64 {
+	if req.Tolerance == nil {
+		return defaultTolerance
+	}
+	return *req.Tolerance
+}
+
+// vehicle returns the saved vehicle profile the request names, or nil if it
+// doesn't name one
+func (req CalculateRequest) vehicle() (*Vehicle, error) {
+	if req.Vehicle == "" {
+		return nil, nil
+	}
+	garage, err := loadDefaultGarage()
+	if err != nil {
+		return nil, err
+	}
+	v, err := garage.Vehicle(req.Vehicle)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// withVehicle fills in the request from its vehicle profile, if it names
+// one. The profile supplies the unit, maximum volume, pump model and tank
+// capacity wherever the request leaves them out, as applyVehicle does for
+// the command line. A request in a different unit from the vehicle is an
+// error, since the vehicle's volumes are in its own unit.
+func (req CalculateRequest) withVehicle() (CalculateRequest, error) {
+	v, err := req.vehicle()
+	if err != nil || v == nil {
+		return req, err
+	}
+
+	if req.Unit == "" {
+		req.Unit = v.Unit
+	} else if u, err := ParseVolumeUnit(req.Unit); err == nil && u != volumeUnitByCode(v.Unit) {
+		return req, fmt.Errorf("vehicle %q is measured in %s, not %s", v.Name, volumeUnitByCode(v.Unit).Code, u.Code)
+	}
+	if req.MaxLitres == 0 {
+		req.MaxLitres = v.MaxVolume()
+	}
+	if req.Pump == nil {
+		req.Pump = v.Pump
+	}
+	tank := Tank{Capacity: v.Capacity}
+	if req.Tank != nil {
+		tank = *req.Tank
+		if tank.Capacity == 0 {
+			tank.Capacity = v.Capacity
+		}
+	}
+	req.Tank = &tank
+	return req, nil
+}
+
+// options converts the optional request fields into search options
+func (req CalculateRequest) options() ([]Option, error) {
+	mode, err := ParsePalindromeMode(req.Palindrome)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := ParsePatternInBase(req.Pattern, mode, req.Base)
+	if err != nil {
+		return nil, err
+	}
+	currency, err := ParseCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	fillMode, err := ParseFillMode(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := fillMode.Unit(req.Unit)
+	if err != nil {
+		return nil, err
+	}
+	match, err := ParseMatchTarget(req.Match)
+	if err != nil {
+		return nil, err
+	}
+	opts := []Option{WithPattern(pattern), WithCurrency(currency), WithVolumeUnit(unit), WithMatch(match)}
+
+	if req.Pump != nil {
+		if err := req.Pump.Validate(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPumpModel(*req.Pump))
+	}
+
+	if req.MinWindowMl < 0 {
+		return nil, fmt.Errorf("minimum window must not be negative")
+	}
+	opts = append(opts, WithMinWindow(req.MinWindowMl), WithMinScore(req.MinScore))
+
+	budget := Budget{Min: req.MinSpend, Max: req.MaxSpend}
+	if err := budget.Validate(); err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithBudget(budget))
+
+	if req.Discount != nil {
+		if err := req.Discount.Validate(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithDiscount(*req.Discount))
+	}
+
+	for _, item := range req.Items {
+		if err := item.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(req.Items) > 0 {
+		opts = append(opts, WithExtras(req.Items...))
+	}
+
+	if req.VAT != nil {
+		if err := req.VAT.Validate(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithVAT(*req.VAT))
+	}
+
+	if req.Fees != nil {
+		if err := req.Fees.Validate(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithChargingFees(*req.Fees))
+	}
+
+	if req.Tank != nil {
+		if err := req.Tank.Validate(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTank(*req.Tank))
+	}
+
+	return opts, nil
+}
+
+// sortOrder returns the requested sort order
+func (req CalculateRequest) sortOrder() (SortOrder, error) {
+	return ParseSortOrder(req.Sort)
+}
+
+// SplitRequest asks which totals can be split into matching payments. The
+// search fields are the same as in CalculateRequest.
+type SplitRequest struct {
+	CalculateRequest
+	Split
+}
+
+// UnmarshalJSON reads the search and the split from the same object, which
+// embedding alone would not since CalculateRequest has its own UnmarshalJSON
+func (req *SplitRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &req.CalculateRequest); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &req.Split)
+}
+
+// SplitResponse is the split planner API's reply
+type SplitResponse struct {
+	Results []SplitResult `json:"results"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// NextTargetsRequest asks for the stop points ahead of the pump's current
+// reading, given as litres or, failing that, cost. The search fields are
+// the same as in CalculateRequest, apart from maxLitres, which isn't needed.
+type NextTargetsRequest struct {
+	CalculateRequest
+	Litres float64 `json:"litres,omitempty"` // the pump's volume, in unit
+	Cost   float64 `json:"cost,omitempty"`   // the pump's total, in major currency units
+	Count  int     `json:"count,omitempty"`  // how many targets, DefaultNextTargets if unset
+}
+
+// UnmarshalJSON reads the search and the reading from the same object
+func (req *NextTargetsRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &req.CalculateRequest); err != nil {
+		return err
+	}
+	var reading struct {
+		Litres float64 `json:"litres"`
+		Cost   float64 `json:"cost"`
+		Count  int     `json:"count"`
+	}
+	if err := json.Unmarshal(data, &reading); err != nil {
+		return err
+	}
+	req.Litres, req.Cost, req.Count = reading.Litres, reading.Cost, reading.Count
+	return nil
+}
+
+// NextTargetsResponse is the next targets API's reply
+type NextTargetsResponse struct {
+	Results []Target `json:"results"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// FindPricesRequest asks which pump prices make a total. Missing range
+// fields come from DefaultPriceRange, and the search settings mean the same
+// as in CalculateRequest.
+type FindPricesRequest struct {
+	Cost        float64    `json:"cost"`
+	MinPrice    Price      `json:"minPrice,omitempty"`
+	MaxPrice    Price      `json:"maxPrice,omitempty"`
+	Step        Price      `json:"step,omitempty"`
+	Tolerance   *float64   `json:"tolerance,omitempty"`
+	Palindrome  string     `json:"palindrome,omitempty"`
+	Pattern     string     `json:"pattern,omitempty"`
+	Base        int        `json:"base,omitempty"`
+	Pump        *PumpModel `json:"pump,omitempty"`
+	MinWindowMl float64    `json:"minWindowMl,omitempty"`
+	Currency    string     `json:"currency,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+}
+
+// search returns the search settings as a CalculateRequest
+func (req FindPricesRequest) search() CalculateRequest {
+	return CalculateRequest{
+		Tolerance:   req.Tolerance,
+		Palindrome:  req.Palindrome,
+		Pattern:     req.Pattern,
+		Base:        req.Base,
+		Pump:        req.Pump,
+		MinWindowMl: req.MinWindowMl,
+		Currency:    req.Currency,
+		Unit:        req.Unit,
+	}
+}
+
+// priceRange returns the requested prices, filling gaps from DefaultPriceRange
+func (req FindPricesRequest) priceRange() (PriceRange, error) {
+	r := PriceRange{Min: req.MinPrice, Max: req.MaxPrice, Step: req.Step}
+	if r.Min == "" {
+		r.Min = DefaultPriceRange.Min
+	}
+	if r.Max == "" {
+		r.Max = DefaultPriceRange.Max
+	}
+	if r.Step == "" {
+		r.Step = DefaultPriceRange.Step
+	}
+	return r, r.Validate()
+}
+
+type CalculateResponse struct {
+	Results []Result `json:"results"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type TemplateData struct {
+	Results         []DisplayResult
+	Error           string
+	Tab             string // "prices" for the price finder, empty for totals
+	Request         CalculateRequest
+	PriceRequest    FindPricesRequest
+	DefaultPrices   PriceRange
+	BaseURL         string
+	PalindromeModes []PalindromeMode
+	Patterns        []string
+	SortOrders      []SortOrder
+	Currencies      []Currency
+	VolumeUnits     []VolumeUnit
+	Vehicles        []Vehicle
+}
+
+type DisplayResult struct {
+	Result
+	FormattedLitres string
+	FormattedCost   string
+	FormattedPrice  string
+	FormattedTank   string // tank level after the fill, if the search had a tank
+	FormattedPump   string // pump total, discount and extras, if the search had them
+	FormattedVAT    string // net and VAT lines, if the search had a VAT rate
+	UnitSymbol      string
+	WindowSymbol    string // ml, or Wh for energy
+	BestPick        bool   // the highest scoring result on the page
+}
+
+// newDisplayResult formats a result for the web page
+func newDisplayResult(result Result) DisplayResult {
+	currency := currencyByCode(result.Currency)
+	unit := volumeUnitByCode(result.Unit)
+	return DisplayResult{
+		Result:          result,
+		FormattedLitres: formatResultVolume(result),
+		FormattedCost:   currency.withSymbol(result.CostPounds),
+		FormattedPrice:  currency.formatPrice(result.Price) + "/" + unit.Singular,
+		FormattedTank:   formatTank(result),
+		FormattedPump:   formatPump(result),
+		FormattedVAT:    formatVAT(result),
+		UnitSymbol:      unit.Symbol,
+		WindowSymbol:    unit.WindowSymbol(),
+	}
+}
+
+// formatVAT writes a result's net and VAT lines, or returns "" if the
+// search had no VAT rate
+func formatVAT(result Result) string {
+	if result.VATPounds == "" {
+		return ""
+	}
+	currency := currencyByCode(result.Currency)
+	return fmt.Sprintf("net %s, VAT %s", currency.withSymbol(result.NetPounds), currency.withSymbol(result.VATPounds))
+}
+
+// formatPump describes the pump total a result's receipt total came from,
+// or returns "" if the search had no discount, extras or fees
+func formatPump(result Result) string {
+	if result.PumpPounds == "" {
+		return ""
+	}
+	currency := currencyByCode(result.Currency)
+	where := " at the pump"
+	if volumeUnitByCode(result.Unit).Energy {
+		where = " at the charger"
+	}
+	parts := []string{currency.withSymbol(result.PumpPounds) + where}
+	if result.DiscountPounds != "" {
+		if currency.parseAmount(result.DiscountPounds) == 0 {
+			parts = append(parts, "no discount")
+		} else {
+			parts = append(parts, currency.withSymbol(result.DiscountPounds)+" off")
+		}
+	}
+	if result.ExtrasPounds != "" {
+		parts = append(parts, currency.withSymbol(result.ExtrasPounds)+" of extras")
+	}
+	if result.FeesPounds != "" {
+		parts = append(parts, currency.withSymbol(result.FeesPounds)+" of fees")
+	}
+	if result.PumpMatches {
+		parts = append(parts, "both match")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatTank describes the tank level after a result's fill, or returns ""
+// if the search had no tank
+func formatTank(result Result) string {
+	symbol := volumeUnitByCode(result.Unit).Symbol
+	switch {
+	case result.TankFull > 0:
+		return fmt.Sprintf("%.1f %s, %.0f%% full", result.TankLevel, symbol, result.TankFull*100)
+	case result.TankLevel > 0:
+		return fmt.Sprintf("%.1f %s", result.TankLevel, symbol)
+	}
+	return ""
+}
+
+// pumpModelFromQuery reads an optional pump model from query parameters,
+// returning nil if none of them are present
+func pumpModelFromQuery(q url.Values) (*PumpModel, error) {
+	if q.Get("volumeDecimals") == "" && q.Get("volumeRounding") == "" &&
+		q.Get("costRounding") == "" && q.Get("costBasis") == "" {
+		return nil, nil
+	}
+
+	volumeDecimals := DefaultPumpModel.VolumeDecimals
+	if s := q.Get("volumeDecimals"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volumeDecimals parameter")
+		}
+		volumeDecimals = n
+	}
+
+	pump, err := parsePumpModel(volumeDecimals, q.Get("volumeRounding"), q.Get("costRounding"), q.Get("costBasis"))
+	if err != nil {
+		return nil, err
+	}
+	return &pump, nil
+}
+
+// tankFromValues reads an optional tank from the query or form values tank,
+// level and minFill, returning nil if none of them are present. A level
+// given as a fraction of a tank with no capacity uses vehicle's capacity.
+func tankFromValues(get func(string) string, vehicle *Vehicle) (*Tank, error) {
+	if get("tank") == "" && get("level") == "" && get("minFill") == "" {
+		return nil, nil
+	}
+
+	var tank Tank
+	var err error
+	if s := get("tank"); s != "" {
+		if tank.Capacity, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("invalid tank parameter")
+		}
+	}
+	if s := get("minFill"); s != "" {
+		if tank.MinFill, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("invalid minFill parameter")
+		}
+	}
+	capacity := tank.Capacity
+	if capacity == 0 && vehicle != nil {
+		capacity = vehicle.Capacity
+	}
+	if tank.Level, err = ParseTankLevel(get("level"), capacity); err != nil {
+		return nil, err
+	}
+	return &tank, nil
+}
+
+// discountFromValues reads an optional discount from the query or form
+// values discountPerUnit, discountPercent, discountFixed and discountOver,
+// returning nil if none of them are present
+func discountFromValues(get func(string) string) (*Discount, error) {
+	var d Discount
+	fields := []struct {
+		name  string
+		value *float64
+	}{
+		{"discountPerUnit", &d.PerUnit},
+		{"discountPercent", &d.Percent},
+		{"discountFixed", &d.Fixed},
+		{"discountOver", &d.Threshold},
+	}
+
+	found := false
+	for _, f := range fields {
+		if s := get(f.name); s != "" {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s parameter", f.name)
+			}
+			*f.value = v
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+// feesFromValues reads optional charging fees from the query or form values
+// sessionFee and idleFee, returning nil if neither is present
+func feesFromValues(get func(string) string) (*ChargingFees, error) {
+	var f ChargingFees
+	fields := []struct {
+		name  string
+		value *float64
+	}{
+		{"sessionFee", &f.Session},
+		{"idleFee", &f.Idle},
+	}
+
+	found := false
+	for _, field := range fields {
+		if s := get(field.name); s != "" {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s parameter", field.name)
+			}
+			*field.value = v
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+// vatFromValues reads an optional VAT model from the query or form values
+// vat (the rate) and vatRounding, returning nil if no rate is given
+func vatFromValues(get func(string) string) (*VAT, error) {
+	s := get("vat")
+	if s == "" {
+		return nil, nil
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vat parameter")
+	}
+	return &VAT{Rate: rate, Rounding: RoundingRule(get("vatRounding"))}, nil
+}
+
+// calculateRequestFromQuery reads a search request from GET query
+// parameters
+func calculateRequestFromQuery(q url.Values) (CalculateRequest, error) {
+	priceStr := q.Get("price")
+	maxStr := q.Get("max")
+	vehicleStr := q.Get("vehicle")
+
+	if priceStr == "" {
+		return CalculateRequest{}, errors.New("Missing price parameter")
+	}
+
+	price, err := ParsePrice(priceStr)
+	if err != nil {
+		return CalculateRequest{}, errors.New("Invalid price parameter")
+	}
+
+	var max int
+	if maxStr != "" {
+		if max, err = strconv.Atoi(maxStr); err != nil {
+			return CalculateRequest{}, errors.New("Invalid max parameter")
+		}
+	}
+
+	req := CalculateRequest{PricePerLitre: price.Float64(), MaxLitres: max, Vehicle: vehicleStr, exactPrice: price}
+
+	if tolStr := q.Get("tolerance"); tolStr != "" {
+		tolerance, err := strconv.ParseFloat(tolStr, 64)
+		if err != nil || tolerance < 0 {
+			return CalculateRequest{}, errors.New("Invalid tolerance parameter")
+		}
+		req.Tolerance = &tolerance
+	}
+
+	req.Palindrome = q.Get("palindrome")
+	req.Pattern = q.Get("pattern")
+	req.Currency = q.Get("currency")
+	req.Unit = q.Get("unit")
+	req.Mode = q.Get("mode")
+	req.Match = q.Get("match")
+
+	if baseStr := q.Get("base"); baseStr != "" {
+		base, err := strconv.Atoi(baseStr)
+		if err != nil {
+			return CalculateRequest{}, errors.New("Invalid base parameter")
+		}
+		req.Base = base
+	}
+
+	if streamStr := q.Get("stream"); streamStr != "" {
+		stream, err := strconv.ParseBool(streamStr)
+		if err != nil {
+			return CalculateRequest{}, errors.New("Invalid stream parameter")
+		}
+		req.Stream = stream
+	}
+
+	req.Sort = q.Get("sort")
+	if minStr := q.Get("minWindow"); minStr != "" {
+		minWindow, err := strconv.ParseFloat(minStr, 64)
+		if err != nil {
+			return CalculateRequest{}, errors.New("Invalid minWindow parameter")
+		}
+		req.MinWindowMl = minWindow
+	}
+	if minStr := q.Get("minScore"); minStr != "" {
+		minScore, err := strconv.ParseFloat(minStr, 64)
+		if err != nil {
+			return CalculateRequest{}, errors.New("Invalid minScore parameter")
+		}
+		req.MinScore = minScore
+	}
+	spends := []struct {
+		name  string
+		value *float64
+	}{
+		{"minSpend", &req.MinSpend},
+		{"maxSpend", &req.MaxSpend},
+	}
+	for _, spend := range spends {
+		if spendStr := q.Get(spend.name); spendStr != "" {
+			if *spend.value, err = strconv.ParseFloat(spendStr, 64); err != nil {
+				return CalculateRequest{}, errors.New("Invalid " + spend.name + " parameter")
+			}
+		}
+	}
+
+	if pump, err := pumpModelFromQuery(q); err != nil {
+		return CalculateRequest{}, err
+	} else if pump != nil {
+		req.Pump = pump
+	}
+
+	if req.Discount, err = discountFromValues(q.Get); err != nil {
+		return CalculateRequest{}, err
+	}
+	if req.VAT, err = vatFromValues(q.Get); err != nil {
+		return CalculateRequest{}, err
+	}
+	if req.Fees, err = feesFromValues(q.Get); err != nil {
+		return CalculateRequest{}, err
+	}
+	for _, itemStr := range q["item"] {
+		item, err := ParseExtra(itemStr)
+		if err != nil {
+			return CalculateRequest{}, err
+		}
+		req.Items = append(req.Items, item)
+	}
+
+	vehicle, err := req.vehicle()
+	if err != nil {
+		return CalculateRequest{}, err
+	}
+	if req.Tank, err = tankFromValues(q.Get, vehicle); err != nil {
+		return CalculateRequest{}, err
+	}
+	return req, nil
+}
+
+// handleAPI handles the REST API endpoint
+func handleAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" && r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CalculateRequest
+	if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid JSON"})
+			return
+		}
+	} else {
+		// A vehicle profile knows how far to search
+		q := r.URL.Query()
+		if q.Get("price") == "" || (q.Get("max") == "" && q.Get("vehicle") == "") {
+			json.NewEncoder(w).Encode(CalculateResponse{Error: "Missing price or max parameters"})
+			return
+		}
+
+		var err error
+		if req, err = calculateRequestFromQuery(q); err != nil {
+			json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	req, err := req.withVehicle()
+	if err != nil {
+		json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	opts, err := req.options()
+	if err != nil {
+		json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	order, err := req.sortOrder()
+	if err != nil {
+		json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	if err := ValidateSearch(req.Price(), req.MaxLitres, req.tolerance(), opts...); err != nil {
+		json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	if req.Stream {
+		streamResults(w, r, req, opts, order)
+		return
+	}
+
+	results := FindPalindromicFuelCostsAt(req.Price(), req.MaxLitres, req.tolerance(), opts...)
+	SortResults(results, order)
+	json.NewEncoder(w).Encode(CalculateResponse{Results: results})
+}
+
+// streamResults writes results as newline-delimited JSON, one Result per
+// line, flushing each as it is found. The search stops if the client goes
+// away. Sorting by anything but litres has to wait for every result.
+func streamResults(w http.ResponseWriter, r *http.Request, req CalculateRequest, opts []Option, order SortOrder) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	results := StreamPalindromicFuelCosts(r.Context(), req.Price(), req.MaxLitres, req.tolerance(), opts...)
+	if order != SortByLitres {
+		sorted := slices.Collect(results)
+		SortResults(sorted, order)
+		results = slices.Values(sorted)
+	}
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for result := range results {
+		if err := enc.Encode(result); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleSplit handles the split planner API endpoint
+func handleSplit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" && r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SplitRequest
+	if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(SplitResponse{Error: "Invalid JSON"})
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		if q.Get("price") == "" || (q.Get("max") == "" && q.Get("vehicle") == "") {
+			json.NewEncoder(w).Encode(SplitResponse{Error: "Missing price or max parameters"})
+			return
+		}
+
+		var err error
+		if req.CalculateRequest, err = calculateRequestFromQuery(q); err != nil {
+			json.NewEncoder(w).Encode(SplitResponse{Error: err.Error()})
+			return
+		}
+		if req.Ways, err = strconv.Atoi(q.Get("ways")); err != nil {
+			json.NewEncoder(w).Encode(SplitResponse{Error: "Invalid ways parameter"})
+			return
+		}
+		if equalStr := q.Get("equal"); equalStr != "" {
+			if req.Equal, err = strconv.ParseBool(equalStr); err != nil {
+				json.NewEncoder(w).Encode(SplitResponse{Error: "Invalid equal parameter"})
+				return
+			}
+		}
+	}
+
+	if err := req.Split.Validate(); err != nil {
+		json.NewEncoder(w).Encode(SplitResponse{Error: err.Error()})
+		return
+	}
+
+	search, err := req.withVehicle()
+	if err != nil {
+		json.NewEncoder(w).Encode(SplitResponse{Error: err.Error()})
+		return
+	}
+
+	opts, err := search.options()
+	if err != nil {
+		json.NewEncoder(w).Encode(SplitResponse{Error: err.Error()})
+		return
+	}
+
+	if err := ValidateSearch(search.Price(), search.MaxLitres, search.tolerance(), opts...); err != nil {
+		json.NewEncoder(w).Encode(SplitResponse{Error: err.Error()})
+		return
+	}
+
+	results := FindSplitPayments(r.Context(), search.Price(), search.MaxLitres, search.tolerance(), req.Split, opts...)
+	json.NewEncoder(w).Encode(SplitResponse{Results: results})
+}
+
+// handleNextTargets handles the next targets API endpoint, for checking
+// where to stop from the pump
+func handleNextTargets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" && r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req NextTargetsRequest
+	if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(NextTargetsResponse{Error: "Invalid JSON"})
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		var err error
+		if req.CalculateRequest, err = calculateRequestFromQuery(q); err != nil {
+			json.NewEncoder(w).Encode(NextTargetsResponse{Error: err.Error()})
+			return
+		}
+		fields := []struct {
+			name  string
+			value *float64
+		}{
+			{"litres", &req.Litres},
+			{"cost", &req.Cost},
+		}
+		for _, f := range fields {
+			if v := q.Get(f.name); v != "" {
+				if *f.value, err = strconv.ParseFloat(v, 64); err != nil {
+					json.NewEncoder(w).Encode(NextTargetsResponse{Error: "Invalid " + f.name + " parameter"})
+					return
+				}
+			}
+		}
+		if countStr := q.Get("count"); countStr != "" {
+			if req.Count, err = strconv.Atoi(countStr); err != nil {
+				json.NewEncoder(w).Encode(NextTargetsResponse{Error: "Invalid count parameter"})
+				return
+			}
+		}
+	}
+
+	if req.Litres <= 0 && req.Cost <= 0 {
+		json.NewEncoder(w).Encode(NextTargetsResponse{Error: "Missing litres or cost of the current reading"})
+		return
+	}
+	if req.Count == 0 {
+		req.Count = DefaultNextTargets
+	}
+	if req.Count < 0 {
+		json.NewEncoder(w).Encode(NextTargetsResponse{Error: "count must be positive"})
+		return
+	}
+
+	search, err := req.withVehicle()
+	if err != nil {
+		json.NewEncoder(w).Encode(NextTargetsResponse{Error: err.Error()})
+		return
+	}
+
+	opts, err := search.options()
+	if err != nil {
+		json.NewEncoder(w).Encode(NextTargetsResponse{Error: err.Error()})
+		return
+	}
+
+	current := req.Litres
+	if current <= 0 {
+		currency, _ := ParseCurrency(search.Currency)
+		current = litresForCost(search.Price(), req.Cost, currency)
+	}
+
+	if err := ValidateSearch(search.Price(), nextTargetsMax(current), search.tolerance(), opts...); err != nil {
+		json.NewEncoder(w).Encode(NextTargetsResponse{Error: err.Error()})
+		return
+	}
+
+	targets := NextTargets(search.Price(), current, req.Count, search.tolerance(), opts...)
+	json.NewEncoder(w).Encode(NextTargetsResponse{Results: targets})
+}
+
+// handleFindPrices handles the price finder API endpoint
+func handleFindPrices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method != "POST" && r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FindPricesRequest
+	if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid JSON"})
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		costStr := q.Get("cost")
+		if costStr == "" {
+			json.NewEncoder(w).Encode(CalculateResponse{Error: "Missing cost parameter"})
+			return
+		}
+
+		cost, err := strconv.ParseFloat(costStr, 64)
+		if err != nil {
+			json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid cost parameter"})
+			return
+		}
+		req = FindPricesRequest{
+			Cost:       cost,
+			Palindrome: q.Get("palindrome"),
+			Pattern:    q.Get("pattern"),
+			Currency:   q.Get("currency"),
+			Unit:       q.Get("unit"),
+		}
+
+		fields := []struct {
+			name  string
+			value *Price
+		}{
+			{"minPrice", &req.MinPrice},
+			{"maxPrice", &req.MaxPrice},
+			{"step", &req.Step},
+		}
+		for _, f := range fields {
+			if v := q.Get(f.name); v != "" {
+				if *f.value, err = ParsePrice(v); err != nil {
+					json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid " + f.name + " parameter"})
+					return
+				}
+			}
+		}
+
+		if tolStr := q.Get("tolerance"); tolStr != "" {
+			tolerance, err := strconv.ParseFloat(tolStr, 64)
+			if err != nil || tolerance < 0 {
+				json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid tolerance parameter"})
+				return
+			}
+			req.Tolerance = &tolerance
+		}
+
+		if baseStr := q.Get("base"); baseStr != "" {
+			if req.Base, err = strconv.Atoi(baseStr); err != nil {
+				json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid base parameter"})
+				return
+			}
+		}
+
+		if minStr := q.Get("minWindow"); minStr != "" {
+			if req.MinWindowMl, err = strconv.ParseFloat(minStr, 64); err != nil {
+				json.NewEncoder(w).Encode(CalculateResponse{Error: "Invalid minWindow parameter"})
+				return
+			}
+		}
+
+		if req.Pump, err = pumpModelFromQuery(q); err != nil {
+			json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if req.Cost <= 0 {
+		json.NewEncoder(w).Encode(CalculateResponse{Error: "Cost must be positive"})
+		return
+	}
+
+	prices, err := req.priceRange()
+	if err != nil {
+		json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	search := req.search()
+	opts, err := search.options()
+	if err != nil {
+		json.NewEncoder(w).Encode(CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	results := FindPricesForCostAt(req.Cost, prices, search.tolerance(), opts...)
+	json.NewEncoder(w).Encode(CalculateResponse{Results: results})
+}
+
+// requestFromForm reads a calculation request from the web form
+func requestFromForm(r *http.Request) (CalculateRequest, error) {
+	req := CalculateRequest{
+		Palindrome: r.FormValue("palindrome"),
+		Pattern:    r.FormValue("pattern"),
+		Sort:       r.FormValue("sort"),
+		Currency:   r.FormValue("currency"),
+		Unit:       r.FormValue("unit"),
+		Vehicle:    r.FormValue("vehicle"),
+		Mode:       r.FormValue("mode"),
+		Match:      r.FormValue("match"),
+	}
+	// The unit picker is switched off while charging
+	if req.Mode == string(FillEV) {
+		req.Unit = ""
+	}
+
+	var err error
+	if req.exactPrice, err = ParsePrice(r.FormValue("price")); err != nil {
+		return req, err
+	}
+	req.PricePerLitre = req.exactPrice.Float64()
+	if s := r.FormValue("max"); s != "" || req.Vehicle == "" {
+		if req.MaxLitres, err = strconv.Atoi(s); err != nil {
+			return req, err
+		}
+	}
+	if s := r.FormValue("minWindow"); s != "" {
+		if req.MinWindowMl, err = strconv.ParseFloat(s, 64); err != nil {
+			return req, err
+		}
+	}
+	if s := r.FormValue("base"); s != "" {
+		if req.Base, err = strconv.Atoi(s); err != nil {
+			return req, err
+		}
+	}
+	if s := r.FormValue("minScore"); s != "" {
+		if req.MinScore, err = strconv.ParseFloat(s, 64); err != nil {
+			return req, err
+		}
+	}
+	if s := r.FormValue("minSpend"); s != "" {
+		if req.MinSpend, err = strconv.ParseFloat(s, 64); err != nil {
+			return req, err
+		}
+	}
+	if s := r.FormValue("maxSpend"); s != "" {
+		if req.MaxSpend, err = strconv.ParseFloat(s, 64); err != nil {
+			return req, err
+		}
+	}
+	if req.Discount, err = discountFromValues(r.FormValue); err != nil {
+		return req, err
+	}
+	if req.Items, err = itemsFromForm(r); err != nil {
+		return req, err
+	}
+	if req.VAT, err = vatFromValues(r.FormValue); err != nil {
+		return req, err
+	}
+	if req.Fees, err = feesFromValues(r.FormValue); err != nil {
+		return req, err
+	}
+	vehicle, err := req.vehicle()
+	if err != nil {
+		return req, err
+	}
+	if req.Tank, err = tankFromValues(r.FormValue, vehicle); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// itemsFromForm reads the basket's line items from the web form's paired
+// itemName and itemPrice fields, skipping empty rows
+func itemsFromForm(r *http.Request) ([]Extra, error) {
+	names, prices := r.Form["itemName"], r.Form["itemPrice"]
+	var items []Extra
+	for i, name := range names {
+		price := ""
+		if i < len(prices) {
+			price = prices[i]
+		}
+		if strings.TrimSpace(name) == "" && strings.TrimSpace(price) == "" {
+			continue
+		}
+		item, err := ParseExtra(name + "=" + price)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// markBestPick highlights the first of the highest scoring results
+func markBestPick(results []DisplayResult) {
+	best := -1
+	for i, result := range results {
+		if best < 0 || result.Score > results[best].Score {
+			best = i
+		}
+	}
+	if best >= 0 {
+		results[best].BestPick = true
+	}
+}
+
+// findPricesRequestFromForm reads a price finder request from the web form
+func findPricesRequestFromForm(r *http.Request) (FindPricesRequest, error) {
+	req := FindPricesRequest{
+		Palindrome: r.FormValue("palindrome"),
+		Pattern:    r.FormValue("pattern"),
+		Currency:   r.FormValue("currency"),
+		Unit:       r.FormValue("unit"),
+	}
+
+	var err error
+	if req.Cost, err = strconv.ParseFloat(r.FormValue("cost"), 64); err != nil || req.Cost <= 0 {
+		return req, fmt.Errorf("invalid total %q", r.FormValue("cost"))
+	}
+	if s := r.FormValue("tolerance"); s != "" {
+		tolerance, err := strconv.ParseFloat(s, 64)
+		if err != nil || tolerance < 0 {
+			return req, fmt.Errorf("invalid tolerance %q", s)
+		}
+		req.Tolerance = &tolerance
+	}
+	fields := []struct {
+		name  string
+		value *Price
+	}{
+		{"minPrice", &req.MinPrice},
+		{"maxPrice", &req.MaxPrice},
+		{"step", &req.Step},
+	}
+	for _, f := range fields {
+		if v := r.FormValue(f.name); v != "" {
+			if *f.value, err = ParsePrice(v); err != nil {
+				return req, err
+			}
+		}
+	}
+
+	return req, nil
+}
+
+// handleWebUI handles the web interface
+func handleWebUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Construct base URL from request
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	baseURL := scheme + "://" + r.Host
+
+	data := TemplateData{
+		BaseURL:         baseURL,
+		PalindromeModes: palindromeModes,
+		Patterns:        patternNames,
+		SortOrders:      sortOrders,
+		Currencies:      currencies,
+		VolumeUnits:     volumeUnits,
+		Tab:             r.URL.Query().Get("tab"),
+		DefaultPrices:   DefaultPriceRange,
+	}
+	if garage, err := loadDefaultGarage(); err != nil {
+		data.Error = err.Error()
+	} else {
+		data.Vehicles = garage.Vehicles
+	}
+
+	if r.Method == "POST" && data.Tab == "prices" {
+		r.ParseForm()
+		if r.FormValue("cost") != "" {
+			req, err := findPricesRequestFromForm(r)
+			data.PriceRequest = req
+
+			var prices PriceRange
+			var opts []Option
+			if err == nil {
+				prices, err = req.priceRange()
+			}
+			if err == nil {
+				opts, err = req.search().options()
+			}
+
+			if err != nil {
+				data.Error = err.Error()
+			} else {
+				for _, result := range FindPricesForCostAt(req.Cost, prices, req.search().tolerance(), opts...) {
+					data.Results = append(data.Results, newDisplayResult(result))
+				}
+				markBestPick(data.Results)
+				if len(data.Results) == 0 {
+					data.Error = "No prices in that range make this total"
+				}
+			}
+		}
+	} else if r.Method == "POST" {
+		r.ParseForm()
+		priceStr := r.FormValue("price")
 		maxStr := r.FormValue("max")
+		vehicleStr := r.FormValue("vehicle")
 
-		if priceStr != "" && maxStr != "" {
-			price, err1 := strconv.ParseFloat(priceStr, 64)
-			max, err2 := strconv.Atoi(maxStr)
+		if priceStr != "" && (maxStr != "" || vehicleStr != "") {
+			req, err := requestFromForm(r)
+			data.Request = req
 
-			if err1 == nil && err2 == nil {
-				data.Request = CalculateRequest{PricePerLitre: price, MaxLitres: max}
-				results := FindPalindromicFuelCosts(price, max, 0.01)
+			// Search with the vehicle's settings, but leave the form as entered
+			search, vehicleErr := req.withVehicle()
+
+			var opts []Option
+			var order SortOrder
+			if err == nil && vehicleErr == nil {
+				opts, err = search.options()
+			}
+			if err == nil {
+				order, err = req.sortOrder()
+			}
+			req = search
+
+			if vehicleErr != nil {
+				data.Error = vehicleErr.Error()
+			} else if err != nil {
+				data.Error = "Invalid input values"
+			} else if err := ValidateSearch(req.Price(), req.MaxLitres, req.tolerance(), opts...); err != nil {
+				data.Error = err.Error()
+			} else {
+				results := FindPalindromicFuelCostsAt(req.Price(), req.MaxLitres, req.tolerance(), opts...)
+				SortResults(results, order)
 				data.Results = make([]DisplayResult, len(results))
 				for i, result := range results {
-					formattedLitres := fmt.Sprintf("%.2f", result.Litres)
-					if result.Litres == math.Floor(result.Litres) {
-						formattedLitres = fmt.Sprintf("%.0f", result.Litres)
-					}
-					data.Results[i] = DisplayResult{
-						Result:          result,
-						FormattedLitres: formattedLitres,
-					}
+					data.Results[i] = newDisplayResult(result)
 				}
-			} else {
-				data.Error = "Invalid input values"
+				markBestPick(data.Results)
+			}
+		}
+	}
+
+	t, err := template.New("webui").Parse(tmpl)
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	t.Execute(w, data)
+}
+
+// runVehicleCommand runs the vehicle subcommand on the garage saved at path:
+// add NAME [flags], list or remove NAME
+func runVehicleCommand(args []string, path string, out io.Writer) error {
+	const usage = "usage: vehicle add NAME -capacity=N [flags] | vehicle list | vehicle remove NAME"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	garage, err := LoadGarage(path)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if len(garage.Vehicles) == 0 {
+			fmt.Fprintln(out, "No saved vehicles. Add one with: vehicle add NAME -capacity=55")
+			return nil
+		}
+		for _, v := range garage.Vehicles {
+			fmt.Fprintln(out, v)
+		}
+		return nil
+
+	case "add":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return errors.New(usage)
+		}
+		fs := flag.NewFlagSet("vehicle add", flag.ContinueOnError)
+		fs.SetOutput(out)
+		capacity := fs.Float64("capacity", 0, "Tank capacity, in -unit (required)")
+		fuel := fs.String("fuel", "", "Fuel type, like petrol or diesel")
+		unitCode := fs.String("unit", Litres.Code, "Volume unit the tank is measured in: litres, us-gallons or imperial-gallons")
+		typicalFill := fs.Float64("typical-fill", 0, "Usual fill, searched up to instead of a full tank")
+		volumeDecimals := fs.Int("volume-dp", DefaultPumpModel.VolumeDecimals, "Decimal places the usual pump displays volume to (-1 = usual for -unit)")
+		volumeRounding := fs.String("volume-rounding", string(DefaultPumpModel.VolumeRounding), "How the usual pump rounds displayed volume")
+		costRounding := fs.String("cost-rounding", string(DefaultPumpModel.CostRounding), "How the usual pump rounds the displayed cost")
+		costBasis := fs.String("cost-basis", string(DefaultPumpModel.CostBasis), "Volume the usual pump prices: metered or displayed")
+		if err := fs.Parse(args[2:]); err != nil {
+			return err
+		}
+		if fs.NArg() > 0 {
+			return fmt.Errorf("unexpected arguments %q", fs.Args())
+		}
+
+		unit, err := ParseVolumeUnit(*unitCode)
+		if err != nil {
+			return err
+		}
+		v := Vehicle{
+			Name:        args[1],
+			Capacity:    *capacity,
+			FuelType:    strings.ToLower(strings.TrimSpace(*fuel)),
+			Unit:        unit.Code,
+			TypicalFill: *typicalFill,
+		}
+
+		// Only save a pump model if it was described
+		pumpSet := false
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "volume-dp", "volume-rounding", "cost-rounding", "cost-basis":
+				pumpSet = true
+			}
+		})
+		if pumpSet {
+			pump, err := parsePumpModel(*volumeDecimals, *volumeRounding, *costRounding, *costBasis)
+			if err != nil {
+				return err
+			}
+			v.Pump = &pump
+		}
+
+		replaced, err := garage.Add(v)
+		if err != nil {
+			return err
+		}
+		if err := garage.Save(path); err != nil {
+			return err
+		}
+		if replaced {
+			fmt.Fprintf(out, "Updated %s\n", v)
+		} else {
+			fmt.Fprintf(out, "Saved %s\n", v)
+		}
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		if err := garage.Remove(args[1]); err != nil {
+			return err
+		}
+		if err := garage.Save(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Removed %s\n", args[1])
+		return nil
+	}
+	return fmt.Errorf("unknown vehicle command %q (%s)", args[0], usage)
+}
+
+// applyVehicle sets the flags the command line left alone from a saved
+// vehicle profile: the unit, maximum volume, tank capacity and pump model
+func applyVehicle(fs *flag.FlagSet, v Vehicle) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if set["unit"] {
+		if u, err := ParseVolumeUnit(fs.Lookup("unit").Value.String()); err == nil && u != volumeUnitByCode(v.Unit) {
+			return fmt.Errorf("vehicle %q is measured in %s, not %s", v.Name, volumeUnitByCode(v.Unit).Code, u.Code)
+		}
+	}
+
+	values := map[string]string{
+		"unit": volumeUnitByCode(v.Unit).Code,
+		"max":  strconv.Itoa(v.MaxVolume()),
+		"tank": strconv.FormatFloat(v.Capacity, 'g', -1, 64),
+	}
+	if v.Pump != nil {
+		values["volume-dp"] = strconv.Itoa(v.Pump.VolumeDecimals)
+		values["volume-rounding"] = string(v.Pump.VolumeRounding)
+		values["cost-rounding"] = string(v.Pump.CostRounding)
+		values["cost-basis"] = string(v.Pump.CostBasis)
+	}
+	for name, value := range values {
+		if !set[name] {
+			if err := fs.Set(name, value); err != nil {
+				return err
 			}
 		}
 	}
-
-	t, err := template.New("webui").Parse(tmpl)
+	return nil
+}
+
+func main() {
+	// Vehicle profiles are managed with a subcommand
+	if len(os.Args) > 1 && os.Args[1] == "vehicle" {
+		path, err := DefaultGaragePath()
+		if err == nil {
+			err = runVehicleCommand(os.Args[2:], path, os.Stdout)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	pricePtr := flag.String("price", "", "Price per litre (or -unit) in minor currency units, like pence (required)")
+	maxLitresPtr := flag.Int("max", 10000, "Maximum volume to check, in -unit")
+	reverseLitresPtr := flag.Float64("reverse-litres", 0, "Find nearest palindrome to this volume, in -unit")
+	reversePricePtr := flag.Float64("reverse-price", 0, "Find palindromes near this target price in major currency units, like pounds")
+	findPricesPtr := flag.Float64("find-prices", 0, "Find the prices in -price-range that make this total in major currency units, like pounds")
+	priceRangePtr := flag.String("price-range", "", "Sweep these prices, or try them with -find-prices, as min:max:step in minor currency units (default "+DefaultPriceRange.String()+")")
+	formatPtr := flag.String("format", "table", "Price sweep output: table, csv or json")
+	triplePtr := flag.Bool("triple", false, "Sweep -price-range for receipts where the price, litres and cost are all palindromes")
+	searchRadiusPtr := flag.Int("radius", 100, "Search radius for reverse lookup, in -unit or minor currency units")
+	tolerancePtr := flag.Float64("tolerance", defaultTolerance, "Pump tolerance in -unit: how far from a whole unit still counts as whole (0 = exact)")
+	epsilonPtr := flag.Float64("epsilon", -1, "Deprecated alias for -tolerance")
+	volumeDecimalsPtr := flag.Int("volume-dp", DefaultPumpModel.VolumeDecimals, "Decimal places the pump displays volume to (-1 = usual for -unit)")
+	volumeRoundingPtr := flag.String("volume-rounding", string(DefaultPumpModel.VolumeRounding), "How the pump rounds displayed volume: half-up, half-even, up or down")
+	costRoundingPtr := flag.String("cost-rounding", string(DefaultPumpModel.CostRounding), "How the pump rounds the displayed cost: half-up, half-even, up or down")
+	costBasisPtr := flag.String("cost-basis", string(DefaultPumpModel.CostBasis), "Volume the pump prices: metered (exact) or displayed (rounded)")
+	sortPtr := flag.String("sort", "litres", "Result order: litres, window (most forgiving stop window first) or score (most satisfying first)")
+	minWindowPtr := flag.Float64("min-window", 0, "Only show results whose stop window is at least this many millilitres")
+	minScorePtr := flag.Float64("min-score", 0, "Only show results scoring at least this much")
+	tankPtr := flag.Float64("tank", 0, "Tank capacity in -unit; only fills that fit are shown")
+	levelPtr := flag.String("level", "", "Fuel already in the tank: a volume in -unit, a fraction like 1/4 or a percentage like 25%")
+	minFillPtr := flag.Float64("min-fill", 0, "Smallest fill worth stopping for, in -unit")
+	minSpendPtr := flag.Float64("min-spend", 0, "Only show costs of at least this much, in major currency units like pounds")
+	maxSpendPtr := flag.Float64("max-spend", 0, "Only show costs of at most this much, in major currency units like pounds")
+	discountPerUnitPtr := flag.Float64("discount-per-unit", 0, "Receipt discount per -unit in minor currency units, like 5 for 5p off a litre")
+	discountPercentPtr := flag.Float64("discount-percent", 0, "Receipt discount as a percentage of the pump total")
+	discountFixedPtr := flag.Float64("discount-fixed", 0, "Receipt discount in major currency units, like 2 for £2 off")
+	discountOverPtr := flag.Float64("discount-over", 0, "Only discount pump totals of at least this much, in major currency units")
+	var extras extrasFlag
+	flag.Var(&extras, "extra", "Shop item on the same receipt as name=price in major currency units, like wash=6.50; repeat for more")
+	vatPtr := flag.Float64("vat", 0, "VAT rate included in the receipt total, in percent like 20; shows the net and VAT lines (0 = none)")
+	vatRoundingPtr := flag.String("vat-rounding", string(RoundHalfUp), "How the VAT rounds to the penny: half-up, half-even, up or down")
+	vehiclePtr := flag.String("vehicle", "", "Saved vehicle profile to search for (see: vehicle list); sets -unit, -max, -tank and the pump unless given")
+	patternPtr := flag.String("pattern", "palindrome", "Pattern to find: "+strings.Join(patternNames, ", "))
+	palindromePtr := flag.String("palindrome", "literal", "Palindrome definition: literal (50.05), digits (123.21 as 12321) or symbol (£12.13, the £ facing the last digit)")
+	basePtr := flag.Int("base", 10, "Base the cost in minor units has to be a palindrome in, 2-36 (e.g. 2 for binary, 16 for hex)")
+	currencyPtr := flag.String("currency", GBP.Code, "Currency prices and costs are in: GBP, EUR, USD, JPY or KWD")
+	unitPtr := flag.String("unit", "", "Volume unit prices are per: litres, us-gallons, imperial-gallons or kwh (default litres, or kwh with -mode=ev)")
+	fillModePtr := flag.String("mode", string(FillFuel), "What you're buying: fuel, or ev for a charging session priced per kWh")
+	sessionFeePtr := flag.Float64("session-fee", 0, "EV connection or session fee in major currency units, like 0.35")
+	idleFeePtr := flag.Float64("idle-fee", 0, "EV idle or overstay fees in major currency units")
+	matchPtr := flag.String("match", string(MatchTotal), "What has to match the pattern: total, volume (litres or kWh, whatever the total) or both")
+	splitPtr := flag.Int("split", 0, "Find fills whose total can be paid in this many payments that all match too, from 2 to "+strconv.Itoa(MaxSplitWays))
+	splitEqualPtr := flag.Bool("split-equal", false, "With -split, only allow equal payments")
+	fromLitresPtr := flag.Float64("from-litres", 0, "Mid-fill: show the next targets after the pump's current volume, in -unit")
+	fromCostPtr := flag.Float64("from-cost", 0, "Mid-fill: show the next targets after the pump's current cost, in major currency units like pounds")
+	nextPtr := flag.Int("next", DefaultNextTargets, "How many targets -from-litres or -from-cost shows")
+	batchPtr := flag.String("batch", "", "Comma-separated list of prices for batch processing")
+	csvPtr := flag.String("csv", "", "Export results to CSV file (e.g., results.csv)")
+	webPtr := flag.Bool("web", false, "Start web server on port 8080")
+	portPtr := flag.String("port", "8080", "Port for web server")
+
+	flag.Parse()
+
+	if *epsilonPtr >= 0 {
+		*tolerancePtr = *epsilonPtr
+	}
+
+	if *vehiclePtr != "" {
+		garage, err := loadDefaultGarage()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		vehicle, err := garage.Vehicle(*vehiclePtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyVehicle(flag.CommandLine, vehicle); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	mode, err := ParsePalindromeMode(*palindromePtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	pump, err := parsePumpModel(*volumeDecimalsPtr, *volumeRoundingPtr, *costRoundingPtr, *costBasisPtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	order, err := ParseSortOrder(*sortPtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	pattern, err := ParsePatternInBase(*patternPtr, mode, *basePtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	currency, err := ParseCurrency(*currencyPtr)
 	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	t.Execute(w, data)
-}
-
-func main() {
-	pricePtr := flag.Float64("price", 0, "Price per litre in pence (required)")
-	maxLitresPtr := flag.Int("max", 10000, "Maximum litres to check")
-	reverseLitresPtr := flag.Float64("reverse-litres", 0, "Find nearest palindrome to this litre amount")
-	reversePricePtr := flag.Float64("reverse-price", 0, "Find palindromes near this target price in pounds")
-	searchRadiusPtr := flag.Int("radius", 100, "Search radius for reverse lookup")
-	epsilonPtr := flag.Float64("epsilon", 0.01, "Epsilon for integer check")
-	batchPtr := flag.String("batch", "", "Comma-separated list of prices for batch processing")
-	csvPtr := flag.String("csv", "", "Export results to CSV file (e.g., results.csv)")
-	webPtr := flag.Bool("web", false, "Start web server on port 8080")
-	portPtr := flag.String("port", "8080", "Port for web server")
-
-	flag.Parse()
+	fillMode, err := ParseFillMode(*fillModePtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	unit, err := fillMode.Unit(*unitPtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	match, err := ParseMatchTarget(*matchPtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fees := ChargingFees{Session: *sessionFeePtr, Idle: *idleFeePtr}
+	if err := fees.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *minWindowPtr < 0 {
+		fmt.Println("Error: minimum window must not be negative")
+		os.Exit(1)
+	}
+	level, err := ParseTankLevel(*levelPtr, *tankPtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tank := Tank{Capacity: *tankPtr, Level: level, MinFill: *minFillPtr}
+	if err := tank.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	budget := Budget{Min: *minSpendPtr, Max: *maxSpendPtr}
+	if err := budget.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	discount := Discount{PerUnit: *discountPerUnitPtr, Percent: *discountPercentPtr, Fixed: *discountFixedPtr, Threshold: *discountOverPtr}
+	if err := discount.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	vat := VAT{Rate: *vatPtr, Rounding: RoundingRule(*vatRoundingPtr)}
+	if err := vat.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts := []Option{WithPattern(pattern), WithPumpModel(pump), WithCurrency(currency), WithVolumeUnit(unit), WithMinWindow(*minWindowPtr), WithMinScore(*minScorePtr), WithTank(tank), WithBudget(budget), WithDiscount(discount), WithExtras(extras...), WithVAT(vat), WithChargingFees(fees), WithMatch(match)}
 
 	// Web server mode
 	if *webPtr {
@@ -478,14 +5000,145 @@ func main() {
 		fmt.Printf("Starting web server on %s\n", addr)
 		fmt.Printf("Web UI: http://%s\n", addr)
 		fmt.Printf("API: http://%s/api/calculate\n", addr)
+		fmt.Printf("Price finder API: http://%s/api/find-prices\n", addr)
+		fmt.Printf("Split planner API: http://%s/api/split\n", addr)
+		fmt.Printf("Next targets API: http://%s/api/next-targets\n", addr)
 
 		http.HandleFunc("/", handleWebUI)
 		http.HandleFunc("/api/calculate", handleAPI)
+		http.HandleFunc("/api/find-prices", handleFindPrices)
+		http.HandleFunc("/api/split", handleSplit)
+		http.HandleFunc("/api/next-targets", handleNextTargets)
 
 		log.Fatal(http.ListenAndServe(addr, nil))
 	}
 
-	if *pricePtr == 0 && *batchPtr == "" && !*webPtr {
+	// Price finder mode
+	if *findPricesPtr > 0 {
+		prices := DefaultPriceRange
+		if *priceRangePtr != "" {
+			if prices, err = ParsePriceRange(*priceRangePtr); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		target := int64(math.Round(*findPricesPtr * float64(pow10(currency.MinorUnits))))
+		fmt.Printf("\nFinding prices that make %s, from %s to %s/%s in steps of %s\n\n",
+			currency.Format(target), currency.formatPrice(prices.Min), currency.formatPrice(prices.Max), unit.Singular, currency.formatPrice(prices.Step))
+
+		start := time.Now()
+		results := FindPricesForCostAt(*findPricesPtr, prices, *tolerancePtr, opts...)
+		elapsed := time.Since(start)
+		if order != SortByLitres {
+			// Otherwise keep them cheapest first
+			SortResults(results, order)
+		}
+
+		for _, result := range results {
+			fmt.Printf("%s/%s: ", currency.formatPrice(result.Price), unit.Singular)
+			printResult(result)
+		}
+		fmt.Printf("\nFound %d prices in %.3fms\n", len(results), float64(elapsed.Microseconds())/1000.0)
+
+		if *csvPtr != "" {
+			if err := exportToCSV(*csvPtr, slices.Values(results), "", currency, unit); err != nil {
+				fmt.Printf("\nError exporting to CSV: %v\n", err)
+			} else {
+				fmt.Printf("\nResults exported to %s\n", *csvPtr)
+			}
+		}
+		return
+	}
+
+	// Triple palindrome mode
+	if *triplePtr {
+		prices := DefaultPriceRange
+		if *priceRangePtr != "" {
+			if prices, err = ParsePriceRange(*priceRangePtr); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := ValidateSearch(prices.Max, *maxLitresPtr, *tolerancePtr, opts...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("\nFinding triple palindromes from %s to %s/%s in steps of %s\n\n",
+			currency.formatPrice(prices.Min), currency.formatPrice(prices.Max), unit.Singular, currency.formatPrice(prices.Step))
+
+		start := time.Now()
+		results := FindTriplePalindromes(ctx, prices, *maxLitresPtr, *tolerancePtr, opts...)
+		elapsed := time.Since(start)
+		if order != SortByLitres {
+			SortResults(results, order)
+		}
+
+		for _, result := range results {
+			fmt.Printf("%s/%s: ", currency.formatPrice(result.Price), unit.Singular)
+			printResult(result)
+		}
+		fmt.Printf("\nFound %d triple palindromes in %.3fms\n", len(results), float64(elapsed.Microseconds())/1000.0)
+
+		if *csvPtr != "" {
+			if err := exportToCSV(*csvPtr, slices.Values(results), "", currency, unit); err != nil {
+				fmt.Printf("\nError exporting to CSV: %v\n", err)
+			} else {
+				fmt.Printf("\nResults exported to %s\n", *csvPtr)
+			}
+		}
+		return
+	}
+
+	// Price sweep mode
+	if *priceRangePtr != "" {
+		prices, err := ParsePriceRange(*priceRangePtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		sweep, err := SweepPrices(ctx, prices, *maxLitresPtr, *tolerancePtr, opts...)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		switch *formatPtr {
+		case "csv":
+			err = writeSweepCSV(os.Stdout, sweep, currency, unit)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(sweep)
+		case "table", "":
+			err = writeSweepTable(os.Stdout, sweep, currency, unit)
+		default:
+			err = fmt.Errorf("unknown format %q (want table, csv or json)", *formatPtr)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *csvPtr != "" {
+			if err := exportSweepToCSV(*csvPtr, sweep, currency, unit); err != nil {
+				fmt.Printf("\nError exporting to CSV: %v\n", err)
+			} else if *formatPtr == "table" {
+				fmt.Printf("\nResults exported to %s\n", *csvPtr)
+			}
+		}
+		return
+	}
+
+	if *pricePtr == "" && *batchPtr == "" && !*webPtr {
 		fmt.Println("Palindromic Fuel Cost Calculator")
 		fmt.Println("================================")
 		fmt.Println()
@@ -502,6 +5155,22 @@ func main() {
 		fmt.Println("  Reverse lookup (find palindromes near target price):")
 		fmt.Println("    ./palindromic-fuel -price=128.9 -reverse-price=50.00 -radius=500")
 		fmt.Println()
+		fmt.Println("  Price finder (which prices make a total work):")
+		fmt.Println("    ./palindromic-fuel -find-prices=50.05 -price-range=120:160:0.1")
+		fmt.Println()
+		fmt.Println("  Price sweep (how lucky is each price?):")
+		fmt.Println("    ./palindromic-fuel -price-range=120:160:0.1 -max=100 -format=table")
+		fmt.Println()
+		fmt.Println("  Triple palindromes (price, litres and cost):")
+		fmt.Println("    ./palindromic-fuel -triple -price-range=120:160:0.1 -max=100")
+		fmt.Println()
+		fmt.Println("  Split payments (two people, both pay a palindrome):")
+		fmt.Println("    ./palindromic-fuel -price=128.9 -max=100 -split=2")
+		fmt.Println()
+		fmt.Println("  Next targets mid-fill (from the pump's current reading):")
+		fmt.Println("    ./palindromic-fuel -price=128.9 -from-litres=31.40")
+		fmt.Println("    ./palindromic-fuel -price=128.9 -from-cost=40.47 -next=3")
+		fmt.Println()
 		fmt.Println("  Batch mode:")
 		fmt.Println("    ./palindromic-fuel -batch=128.9,135.7,142.3 -max=1000")
 		fmt.Println()
@@ -518,32 +5187,37 @@ func main() {
 	// Batch mode
 	if *batchPtr != "" {
 		priceStrs := strings.Split(*batchPtr, ",")
-		var prices []float64
+		var prices []Price
 
 		for _, priceStr := range priceStrs {
-			price, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
+			price, err := ParsePrice(priceStr)
 			if err != nil {
 				fmt.Printf("Error parsing price '%s': %v\n", priceStr, err)
 				return
 			}
+			if err := ValidateSearch(price, *maxLitresPtr, *tolerancePtr, opts...); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 			prices = append(prices, price)
 		}
 
 		fmt.Printf("\n=== Batch Processing %d Fuel Prices ===\n", len(prices))
 		start := time.Now()
-		results := BatchFindPalindromicCosts(prices, *maxLitresPtr, *epsilonPtr)
+		results := BatchFindPalindromicCostsAt(prices, *maxLitresPtr, *tolerancePtr, opts...)
 		elapsed := time.Since(start)
 
 		fmt.Printf("\nTotal batch time: %.3fms\n", float64(elapsed.Microseconds())/1000.0)
 		fmt.Printf("Average per price: %.3fms\n\n", float64(elapsed.Microseconds())/1000.0/float64(len(prices)))
 
 		for _, price := range prices {
-			printResults(results[price], price)
+			SortResults(results[price], order)
+			printResults(slices.Values(results[price]), price, currency, unit, pattern)
 		}
 
 		// Export to CSV if requested
 		if *csvPtr != "" {
-			if err := exportBatchToCSV(*csvPtr, results, prices); err != nil {
+			if err := exportBatchToCSV(*csvPtr, results, prices, currency, unit); err != nil {
 				fmt.Printf("\nError exporting to CSV: %v\n", err)
 			} else {
 				fmt.Printf("\nResults exported to %s\n", *csvPtr)
@@ -553,22 +5227,28 @@ func main() {
 		return
 	}
 
+	price, err := ParsePrice(*pricePtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Reverse lookup by litres
 	if *reverseLitresPtr > 0 {
-		fmt.Printf("\nFinding nearest palindromic cost to %.2f litres at %.1fp/litre\n", *reverseLitresPtr, *pricePtr)
-		fmt.Printf("Search radius: ±%d litres\n", *searchRadiusPtr)
+		fmt.Printf("\nFinding nearest cost matching the %s pattern to %.2f %s at %s/%s\n", pattern.Name(), *reverseLitresPtr, unit.Plural, currency.formatPrice(price), unit.Singular)
+		fmt.Printf("Search radius: ±%d %s\n", *searchRadiusPtr, unit.Plural)
 
 		start := time.Now()
-		result := FindNearestPalindromicCost(*pricePtr, *reverseLitresPtr, *searchRadiusPtr, *epsilonPtr)
+		result := FindNearestPalindromicCostAt(price, *reverseLitresPtr, *searchRadiusPtr, *tolerancePtr, opts...)
 		elapsed := time.Since(start)
 
 		if result != nil {
-			fmt.Printf("\nNearest palindromic cost:\n")
+			fmt.Printf("\nNearest %s cost:\n", pattern.Name())
 			printResult(*result)
 			diff := math.Abs(result.Litres - *reverseLitresPtr)
-			fmt.Printf("Difference: %.2f litres\n", diff)
+			fmt.Printf("Difference: %.2f %s\n", diff, unit.Plural)
 		} else {
-			fmt.Println("\nNo palindromic costs found in search radius")
+			fmt.Printf("\nNo costs matching the %s pattern found in search radius\n", pattern.Name())
 		}
 
 		fmt.Printf("\nSearch completed in %.3fms\n", float64(elapsed.Microseconds())/1000.0)
@@ -577,82 +5257,278 @@ func main() {
 
 	// Reverse lookup by price
 	if *reversePricePtr > 0 {
-		fmt.Printf("\nFinding palindromic costs near £%.2f at %.1fp/litre\n", *reversePricePtr, *pricePtr)
-		fmt.Printf("Search radius: ±%dp\n", *searchRadiusPtr)
+		target := int64(math.Round(*reversePricePtr * float64(pow10(currency.MinorUnits))))
+		fmt.Printf("\nFinding costs matching the %s pattern near %s at %s/%s\n", pattern.Name(), currency.Format(target), currency.formatPrice(price), unit.Singular)
+		fmt.Printf("Search radius: ±%d%s\n", *searchRadiusPtr, currency.MinorSymbol)
 
 		start := time.Now()
-		results := FindPalindromicCostForTarget(*pricePtr, *reversePricePtr, *searchRadiusPtr, *epsilonPtr)
+		results := FindPalindromicCostForTargetAt(price, *reversePricePtr, *searchRadiusPtr, *tolerancePtr, opts...)
 		elapsed := time.Since(start)
+		SortResults(results, order)
 
 		if len(results) > 0 {
-			fmt.Printf("\nFound %d palindromic cost(s):\n\n", len(results))
+			fmt.Printf("\nFound %d cost(s) matching the %s pattern:\n\n", len(results), pattern.Name())
 			for _, result := range results {
 				printResult(result)
-				targetDiff := math.Abs(parseFloat(result.CostPounds) - *reversePricePtr)
-				fmt.Printf("  Price difference: £%.2f\n", targetDiff)
+				units := int64(math.Round(currency.parseAmount(result.CostPounds) * float64(pow10(currency.MinorUnits))))
+				diff := units - target
+				if diff < 0 {
+					diff = -diff
+				}
+				fmt.Printf("  Price difference: %s\n", currency.Format(diff))
 			}
 		} else {
-			fmt.Println("\nNo palindromic costs found in search radius")
+			fmt.Printf("\nNo costs matching the %s pattern found in search radius\n", pattern.Name())
 		}
 
 		fmt.Printf("\nSearch completed in %.3fms\n", float64(elapsed.Microseconds())/1000.0)
 		return
 	}
 
-	// Normal mode
-	start := time.Now()
-	results := FindPalindromicFuelCosts(*pricePtr, *maxLitresPtr, *epsilonPtr)
-	elapsed := time.Since(start)
+	// Next targets from the pump's current reading. The volume is the more
+	// precise of the two, so it wins when both are given.
+	if *fromLitresPtr > 0 || *fromCostPtr > 0 {
+		if *nextPtr < 1 {
+			fmt.Printf("Error: -next must be at least 1, got %d\n", *nextPtr)
+			os.Exit(1)
+		}
 
-	fmt.Printf("\nPerformance: Found %d results in %.3fms\n", len(results), float64(elapsed.Microseconds())/1000.0)
-	fmt.Printf("Effective range checked: 1-%d litres\n", *maxLitresPtr)
+		current := *fromLitresPtr
+		reading := fmt.Sprintf("%.2f %s", current, unit.Plural)
+		if current == 0 {
+			current = litresForCost(price, *fromCostPtr, currency)
+			reading = currency.Format(int64(math.Round(*fromCostPtr * float64(pow10(currency.MinorUnits)))))
+		}
+		if err := ValidateSearch(price, nextTargetsMax(current), *tolerancePtr, opts...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nNext targets after %s at %s/%s\n\n", reading, currency.formatPrice(price), unit.Singular)
 
-	printResults(results, *pricePtr)
+		start := time.Now()
+		targets := NextTargets(price, current, *nextPtr, *tolerancePtr, opts...)
+		elapsed := time.Since(start)
 
-	// Export to CSV if requested
-	if *csvPtr != "" {
-		if err := exportToCSV(*csvPtr, results, *pricePtr); err != nil {
-			fmt.Printf("\nError exporting to CSV: %v\n", err)
+		if len(targets) > 0 {
+			for _, target := range targets {
+				printResult(target.Result)
+				fmt.Printf("  To go: %s %s, %s\n", strconv.FormatFloat(target.LitresToGo, 'f', unit.Decimals, 64), unit.Plural, currencyByCode(target.Currency).withSymbol(target.CostToGo))
+			}
+		} else {
+			fmt.Println("No targets ahead")
+		}
+
+		fmt.Printf("\nSearch completed in %.3fms\n", float64(elapsed.Microseconds())/1000.0)
+		return
+	}
+
+	// Split planner
+	if *splitPtr != 0 {
+		split := Split{Ways: *splitPtr, Equal: *splitEqualPtr}
+		if err := split.Validate(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := ValidateSearch(price, *maxLitresPtr, *tolerancePtr, opts...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		shares := "any"
+		if split.Equal {
+			shares = "equal"
+		}
+		fmt.Printf("\nFinding totals that split %d ways in %s shares at %s/%s\n\n", split.Ways, shares, currency.formatPrice(price), unit.Singular)
+
+		start := time.Now()
+		results := FindSplitPayments(ctx, price, *maxLitresPtr, *tolerancePtr, split, opts...)
+		elapsed := time.Since(start)
+
+		if len(results) > 0 {
+			fmt.Printf("Found %d splittable cost(s):\n\n", len(results))
+			for _, result := range results {
+				printResult(result.Result)
+				fmt.Printf("  Split: %s\n", formatSplit(result))
+			}
 		} else {
+			fmt.Println("No totals split into matching payments")
+		}
+
+		fmt.Printf("\nSearch completed in %.3fms\n", float64(elapsed.Microseconds())/1000.0)
+		return
+	}
+
+	// Normal mode. Results are printed as they are found, so Ctrl-C stops a
+	// long search without losing what it has shown so far.
+	if err := ValidateSearch(price, *maxLitresPtr, *tolerancePtr, opts...); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Export to CSV if requested, writing each row as it is printed rather
+	// than holding every result in memory or searching twice
+	var export *csvExport
+	var exportErr error
+	if *csvPtr != "" {
+		if export, err = createCSV(*csvPtr, price, currency, unit); err != nil {
+			fmt.Printf("Error exporting to CSV: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	start := time.Now()
+	results := StreamPalindromicFuelCosts(ctx, price, *maxLitresPtr, *tolerancePtr, opts...)
+	if order != SortByLitres {
+		sorted := slices.Collect(results)
+		SortResults(sorted, order)
+		results = slices.Values(sorted)
+	}
+	if export != nil {
+		results = tee(results, func(result Result) {
+			if exportErr == nil {
+				exportErr = export.Write(result)
+			}
+		})
+	}
+
+	count := printResults(results, price, currency, unit, pattern)
+	elapsed := time.Since(start)
+
+	fmt.Printf("\nPerformance: Found %d results in %.3fms\n", count, float64(elapsed.Microseconds())/1000.0)
+	fmt.Printf("Effective range checked: 1-%d %s\n", *maxLitresPtr, unit.Plural)
+
+	if export != nil {
+		if err := export.Close(); exportErr == nil {
+			exportErr = err
+		}
+		switch {
+		case exportErr != nil:
+			fmt.Printf("\nError exporting to CSV: %v\n", exportErr)
+		case ctx.Err() != nil:
+			fmt.Printf("\nSearch interrupted: %s only has the %d results found so far\n", *csvPtr, count)
+		default:
 			fmt.Printf("\nResults exported to %s\n", *csvPtr)
 		}
 	}
 }
 
-func printResults(results []Result, price float64) {
-	fmt.Printf("\nFuel Price: %.1fp/litre\n", price)
-	fmt.Printf("Found %d palindromic costs:\n\n", len(results))
+// tee yields each result after passing it to each
+func tee(results iter.Seq[Result], each func(Result)) iter.Seq[Result] {
+	return func(yield func(Result) bool) {
+		for result := range results {
+			each(result)
+			if !yield(result) {
+				return
+			}
+		}
+	}
+}
 
-	maxShow := 50
-	toShow := results
-	if len(results) > maxShow {
-		toShow = results[:maxShow]
+// printResults prints the first results of a search for pattern as they
+// arrive and counts the rest, returning how many there were
+func printResults(results iter.Seq[Result], price Price, currency Currency, unit VolumeUnit, pattern NumberPattern) int {
+	label := "Fuel Price"
+	if unit.Energy {
+		label = "Charging Price"
 	}
+	fmt.Printf("\n%s: %s/%s\n\n", label, currency.formatPrice(price), unit.Singular)
 
-	for _, result := range toShow {
-		printResult(result)
+	maxShow := 50
+	count := 0
+	for result := range results {
+		if count < maxShow {
+			printResult(result)
+		}
+		count++
 	}
 
-	if len(results) > maxShow {
-		fmt.Printf("\n... and %d more results\n", len(results)-maxShow)
+	if count > maxShow {
+		fmt.Printf("\n... and %d more results\n", count-maxShow)
 	}
+	fmt.Printf("Found %d costs matching the %s pattern\n", count, pattern.Name())
+	return count
 }
 
 func printResult(result Result) {
-	litresStatus := "(whole number litres)"
+	units := volumeUnitByCode(result.Unit).Plural
+	litresStatus := "(whole number " + units + ")"
 	if result.LitresIsPalindrome {
 		if result.Type == "palindromic_decimal" {
-			litresStatus = "(palindromic decimal litres)"
+			litresStatus = "(palindromic decimal " + units + ")"
 		} else {
-			litresStatus = "(palindromic whole litres)"
+			litresStatus = "(palindromic whole " + units + ")"
 		}
 	}
+	if result.Type != "whole" && result.Type != "palindromic_decimal" {
+		litresStatus = fmt.Sprintf("(%s decimal %s)", strings.TrimSuffix(result.Type, "_decimal"), units)
+	}
+
+	window := ""
+	if result.WindowMl > 0 {
+		window = fmt.Sprintf(" [stop window %.1f %s]", result.WindowMl, volumeUnitByCode(result.Unit).WindowSymbol())
+	}
+	if result.Base != 0 {
+		window += fmt.Sprintf(" [base %d: %s]", result.Base, result.Representation)
+	}
+	if result.Score > 0 {
+		window += fmt.Sprintf(" [score %.0f]", result.Score)
+	}
+	if tank := formatTank(result); tank != "" {
+		window += " [tank " + tank + "]"
+	}
+	if pump := formatPump(result); pump != "" {
+		window += " [" + pump + "]"
+	}
+	if vat := formatVAT(result); vat != "" {
+		window += " [" + vat + "]"
+	}
+	if result.NetMatches {
+		window += " [palindromic net]"
+	}
+	if result.VATMatches {
+		window += " [palindromic VAT]"
+	}
+	if result.IsTriplePalindrome() {
+		window += " TRIPLE PALINDROME!"
+	} else if result.PriceIsPalindrome {
+		window += " [palindromic price]"
+	}
+
+	cost := currencyByCode(result.Currency).withSymbol(result.CostPounds)
+	if result.PumpPounds != "" {
+		cost += " on the receipt"
+	}
+	fmt.Printf("%s %s = %s %s%s\n", formatResultVolume(result), units, cost, litresStatus, window)
+}
+
+// formatSplit describes a split's payments, as in £20.02 + £30.03, or
+// 2 × £20.02 when they are all the same
+func formatSplit(result SplitResult) string {
+	currency := currencyByCode(result.Currency)
+	if len(result.Payments) > 0 && result.Payments[0] == result.Payments[len(result.Payments)-1] {
+		return fmt.Sprintf("%d × %s", len(result.Payments), currency.withSymbol(result.Payments[0]))
+	}
+	payments := make([]string, len(result.Payments))
+	for i, payment := range result.Payments {
+		payments[i] = currency.withSymbol(payment)
+	}
+	return strings.Join(payments, " + ")
+}
 
+// formatResultVolume formats a result's volume for display, dropping the
+// decimals of whole units
+func formatResultVolume(result Result) string {
 	if result.Litres == math.Floor(result.Litres) {
-		fmt.Printf("%.0f litres = £%s %s\n", result.Litres, result.CostPounds, litresStatus)
-	} else {
-		fmt.Printf("%.2f litres = £%s %s\n", result.Litres, result.CostPounds, litresStatus)
+		return fmt.Sprintf("%.0f", result.Litres)
+	}
+	if result.Volume != "" {
+		return result.Volume
 	}
+	return fmt.Sprintf("%.2f", result.Litres)
 }
 
 func parseFloat(s string) float64 {
@@ -660,53 +5536,231 @@ func parseFloat(s string) float64 {
 	return f
 }
 
-// exportToCSV exports results to a CSV file
-func exportToCSV(filename string, results []Result, price float64) error {
+// csvHeader returns the header row shared by the CSV exporters, labelled
+// with the currency and volume unit the search was in
+func csvHeader(results []Result, currency Currency, unit VolumeUnit) []string {
+	singular := unit.title(unit.Singular)
+	plural := unit.title(unit.Plural)
+	header := []string{
+		"Price per " + singular + " (" + strings.TrimSpace(currency.MinorSymbol) + ")",
+		plural,
+		"Cost (" + currency.Symbol + ")",
+		plural + " is Palindrome",
+		"Type",
+		"Stop Window (" + unit.WindowSymbol() + ")",
+		"Score",
+		"Price is Palindrome",
+		"Triple Palindrome",
+	}
+	if len(results) > 0 && results[0].Base != 0 {
+		header = append(header, fmt.Sprintf("Cost in Base %d", results[0].Base))
+	}
+	if len(results) > 0 && results[0].PumpPounds != "" {
+		header = append(header, "Pump Total ("+currency.Symbol+")", "Discount ("+currency.Symbol+")", "Extras ("+currency.Symbol+")", "Fees ("+currency.Symbol+")", "Pump Total Matches")
+	}
+	if len(results) > 0 && results[0].VATPounds != "" {
+		header = append(header, "Net ("+currency.Symbol+")", "VAT ("+currency.Symbol+")", "Net Matches", "VAT Matches")
+	}
+	return header
+}
+
+// csvRow formats one result as a CSV row, preferring the exact price the
+// result was found at
+func csvRow(result Result, price Price) []string {
+	if result.Price != "" {
+		price = result.Price
+	}
+	litresStr := formatResultVolume(result)
+
+	litresPalindrome := yesNo(result.LitresIsPalindrome)
+
+	row := []string{
+		price.String(),
+		litresStr,
+		result.CostPounds,
+		litresPalindrome,
+		result.Type,
+		fmt.Sprintf("%.1f", result.WindowMl),
+		fmt.Sprintf("%.1f", result.Score),
+		yesNo(result.PriceIsPalindrome),
+		yesNo(result.IsTriplePalindrome()),
+	}
+	if result.Base != 0 {
+		row = append(row, result.Representation)
+	}
+	if result.PumpPounds != "" {
+		row = append(row, result.PumpPounds, result.DiscountPounds, result.ExtrasPounds, result.FeesPounds, yesNo(result.PumpMatches))
+	}
+	if result.VATPounds != "" {
+		row = append(row, result.NetPounds, result.VATPounds, yesNo(result.NetMatches), yesNo(result.VATMatches))
+	}
+	return row
+}
+
+// yesNo writes a flag as a CSV cell
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
+// exportToCSV exports results of a search in currency and unit to a CSV
+// file, writing each row as it arrives
+func exportToCSV(filename string, results iter.Seq[Result], price Price, currency Currency, unit VolumeUnit) error {
+	export, err := createCSV(filename, price, currency, unit)
+	if err != nil {
+		return err
+	}
+	for result := range results {
+		if err := export.Write(result); err != nil {
+			export.Close()
+			return err
+		}
+	}
+	return export.Close()
+}
+
+// csvExport writes results to a CSV file one row at a time
+type csvExport struct {
+	file        *os.File
+	writer      *csv.Writer
+	price       Price
+	currency    Currency
+	unit        VolumeUnit
+	wroteHeader bool
+}
+
+// createCSV creates a CSV file for results found at price in currency and
+// unit
+func createCSV(filename string, price Price, currency Currency, unit VolumeUnit) (*csvExport, error) {
 	file, err := os.Create(filename)
 	if err != nil {
-		return fmt.Errorf("failed to create CSV file: %w", err)
+		return nil, fmt.Errorf("failed to create CSV file: %w", err)
 	}
-	defer file.Close()
+	return &csvExport{file: file, writer: csv.NewWriter(file), price: price, currency: currency, unit: unit}, nil
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// Write adds a result's row, writing the header first once the first result
+// shows which optional columns there are
+func (e *csvExport) Write(result Result) error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvHeader([]Result{result}, e.currency, e.unit)); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		e.wroteHeader = true
+	}
+	if err := e.writer.Write(csvRow(result, e.price)); err != nil {
+		return fmt.Errorf("failed to write CSV row: %w", err)
+	}
+	return nil
+}
 
-	// Write header
-	header := []string{"Price per Litre (p)", "Litres", "Cost (£)", "Litres is Palindrome", "Type"}
-	if err := writer.Write(header); err != nil {
-		return fmt.Errorf("failed to write CSV header: %w", err)
+// Close writes the header if there were no results and closes the file
+func (e *csvExport) Close() error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvHeader(nil, e.currency, e.unit)); err != nil {
+			e.file.Close()
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
+	e.writer.Flush()
+	if err := e.writer.Error(); err != nil {
+		e.file.Close()
+		return fmt.Errorf("failed to write CSV file: %w", err)
 	}
+	return e.file.Close()
+}
 
-	// Write data
-	for _, result := range results {
-		litresStr := fmt.Sprintf("%.2f", result.Litres)
-		if result.Litres == math.Floor(result.Litres) {
-			litresStr = fmt.Sprintf("%.0f", result.Litres)
+// writeSweepTable prints a sweep as an aligned table followed by its
+// aggregate statistics
+func writeSweepTable(w io.Writer, sweep Sweep, currency Currency, unit VolumeUnit) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Price/%s\tWhole\tDecimal\tDouble\tTotal\t  Best\t\n", unit.Singular)
+	for _, stats := range sweep.Prices {
+		best := "-"
+		if stats.Best != nil {
+			best = fmt.Sprintf("%s %s = %s [%.1f %s]", formatResultVolume(*stats.Best), unit.Symbol, currency.withSymbol(stats.Best.CostPounds), stats.Best.WindowMl, unit.WindowSymbol())
 		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t  %s\t\n", currency.formatPrice(stats.Price), stats.Whole, stats.Decimal, stats.Double, stats.Total, best)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
 
-		litresPalindrome := "No"
-		if result.LitresIsPalindrome {
-			litresPalindrome = "Yes"
+	fmt.Fprintf(w, "\n%d results across %d prices, %.1f per price\n", sweep.Total, len(sweep.Prices), sweep.Mean)
+	if sweep.Luckiest != "" {
+		for _, stats := range sweep.Prices {
+			if stats.Price == sweep.Luckiest {
+				fmt.Fprintf(w, "Luckiest price: %s/%s with %d results\n", currency.formatPrice(stats.Price), unit.Singular, stats.Total)
+			}
+		}
+	}
+	dead := "none"
+	if len(sweep.Dead) > 0 {
+		prices := make([]string, len(sweep.Dead))
+		for i, price := range sweep.Dead {
+			prices[i] = currency.formatPrice(price)
 		}
+		dead = fmt.Sprintf("%d (%s)", len(prices), strings.Join(prices, ", "))
+	}
+	_, err := fmt.Fprintf(w, "Dead prices: %s\n", dead)
+	return err
+}
+
+// writeSweepCSV writes one CSV row per price in a sweep
+func writeSweepCSV(w io.Writer, sweep Sweep, currency Currency, unit VolumeUnit) error {
+	writer := csv.NewWriter(w)
+
+	singular := unit.title(unit.Singular)
+	plural := unit.title(unit.Plural)
+	header := []string{
+		"Price per " + singular + " (" + strings.TrimSpace(currency.MinorSymbol) + ")",
+		"Whole", "Decimal", "Double", "Total",
+		"Best " + plural,
+		"Best Cost (" + currency.Symbol + ")",
+		"Best Stop Window (" + unit.WindowSymbol() + ")",
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
 
+	for _, stats := range sweep.Prices {
 		row := []string{
-			fmt.Sprintf("%.1f", price),
-			litresStr,
-			result.CostPounds,
-			litresPalindrome,
-			result.Type,
+			stats.Price.String(),
+			strconv.Itoa(stats.Whole),
+			strconv.Itoa(stats.Decimal),
+			strconv.Itoa(stats.Double),
+			strconv.Itoa(stats.Total),
+			"", "", "",
+		}
+		if stats.Best != nil {
+			row[5] = formatResultVolume(*stats.Best)
+			row[6] = stats.Best.CostPounds
+			row[7] = fmt.Sprintf("%.1f", stats.Best.WindowMl)
 		}
-
 		if err := writer.Write(row); err != nil {
 			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
 	}
 
-	return nil
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportSweepToCSV exports a sweep to a CSV file
+func exportSweepToCSV(filename string, sweep Sweep, currency Currency, unit VolumeUnit) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	defer file.Close()
+
+	return writeSweepCSV(file, sweep, currency, unit)
 }
 
-// exportBatchToCSV exports batch results to a CSV file
-func exportBatchToCSV(filename string, batchResults map[float64][]Result, prices []float64) error {
+// exportBatchToCSV exports batch results in currency and unit to a CSV file
+func exportBatchToCSV(filename string, batchResults map[Price][]Result, prices []Price, currency Currency, unit VolumeUnit) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to create CSV file: %w", err)
@@ -716,35 +5770,22 @@ func exportBatchToCSV(filename string, batchResults map[float64][]Result, prices
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
 
-	// Write header
-	header := []string{"Price per Litre (p)", "Litres", "Cost (£)", "Litres is Palindrome", "Type"}
-	if err := writer.Write(header); err != nil {
+	// Write header, with the optional columns of the first non-empty result set
+	var sample []Result
+	for _, price := range prices {
+		if len(batchResults[price]) > 0 {
+			sample = batchResults[price]
+			break
+		}
+	}
+	if err := writer.Write(csvHeader(sample, currency, unit)); err != nil {
 		return fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
 	// Write data for each price
 	for _, price := range prices {
-		results := batchResults[price]
-		for _, result := range results {
-			litresStr := fmt.Sprintf("%.2f", result.Litres)
-			if result.Litres == math.Floor(result.Litres) {
-				litresStr = fmt.Sprintf("%.0f", result.Litres)
-			}
-
-			litresPalindrome := "No"
-			if result.LitresIsPalindrome {
-				litresPalindrome = "Yes"
-			}
-
-			row := []string{
-				fmt.Sprintf("%.1f", price),
-				litresStr,
-				result.CostPounds,
-				litresPalindrome,
-				result.Type,
-			}
-
-			if err := writer.Write(row); err != nil {
+		for _, result := range batchResults[price] {
+			if err := writer.Write(csvRow(result, price)); err != nil {
 				return fmt.Errorf("failed to write CSV row: %w", err)
 			}
 		}
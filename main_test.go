@@ -19,11 +19,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
+	"math"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -56,6 +63,32 @@ func TestIsPalindrome(t *testing.T) {
 	}
 }
 
+func TestIsPalindromeInBase(t *testing.T) {
+	tests := []struct {
+		input    int
+		base     int
+		expected bool
+	}{
+		{0, 2, true},
+		{1, 2, true},
+		{9, 2, true},   // 1001
+		{10, 2, false}, // 1010
+		{255, 16, true},
+		{0x1a1, 16, true},
+		{0x1a2, 16, false},
+		{35, 36, true},
+		{37, 36, true}, // 11
+		{121, 10, true},
+		{-5, 2, false},
+	}
+
+	for _, tt := range tests {
+		if got := isPalindromeInBase(tt.input, tt.base); got != tt.expected {
+			t.Errorf("isPalindromeInBase(%d, %d) = %v, want %v", tt.input, tt.base, got, tt.expected)
+		}
+	}
+}
+
 func TestIsPalindromeString(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -138,6 +171,80 @@ func TestGeneratePalindromesForDigits(t *testing.T) {
 	}
 }
 
+func TestPalindromeGenerator(t *testing.T) {
+	for _, from := range []int{-5, 0, 1, 9, 10, 12, 99, 100, 123, 989, 999, 1000, 54321, 99999} {
+		var want []int
+		for n := max(from, 1); len(want) < 25; n++ {
+			if isPalindrome(n) {
+				want = append(want, n)
+			}
+		}
+
+		g := NewPalindromeGenerator(from)
+		var got []int
+		for len(got) < 25 {
+			p, ok := g.Next()
+			if !ok {
+				break
+			}
+			got = append(got, p)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("NewPalindromeGenerator(%d) gave %v, want %v", from, got, want)
+		}
+	}
+
+	// The zero value starts at 1
+	var g PalindromeGenerator
+	if p, ok := g.Next(); !ok || p != 1 {
+		t.Errorf("zero generator started at %d, want 1", p)
+	}
+
+	// Runs out rather than overflowing
+	g.Seek(999999999999999998)
+	if p, ok := g.Next(); !ok || p != 999999999999999999 {
+		t.Errorf("Next() = %d, %v, want the largest 18-digit palindrome", p, ok)
+	}
+	if p, ok := g.Next(); ok {
+		t.Errorf("Next() = %d past the last int palindrome", p)
+	}
+	g.Seek(math.MaxInt)
+	if _, ok := g.Next(); ok {
+		t.Errorf("Seek(math.MaxInt) should leave nothing to generate")
+	}
+
+	for _, base := range []int{MinBase - 1, 0, MaxBase + 1} {
+		if g, err := NewPalindromeGeneratorInBase(1, base); err == nil {
+			t.Errorf("NewPalindromeGeneratorInBase(1, %d) = %v, want an error", base, g)
+		}
+	}
+
+	for _, base := range []int{MinBase, 3, 16, MaxBase} {
+		var want []int
+		for n := 1; n < 5000; n++ {
+			if isPalindromeInBase(n, base) {
+				want = append(want, n)
+			}
+		}
+		if got := palindromesInRange(1, 4999, base); !reflect.DeepEqual(got, want) {
+			t.Errorf("base %d generator gave %v, want %v", base, got, want)
+		}
+
+		var bigGot []int
+		for n := range palindromesInRangeBig(big.NewInt(1), big.NewInt(4999), base) {
+			bigGot = append(bigGot, int(n.Int64()))
+		}
+		if !reflect.DeepEqual(bigGot, want) {
+			t.Errorf("base %d big generator gave %v, want %v", base, bigGot, want)
+		}
+	}
+
+	g.Seek(1000)
+	if allocs := testing.AllocsPerRun(100, func() { g.Next() }); allocs != 0 {
+		t.Errorf("Next allocated %v times per call", allocs)
+	}
+}
+
 func TestFormatPounds(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -163,30 +270,285 @@ func TestFormatPounds(t *testing.T) {
 	}
 }
 
-func TestIsEffectivelyInteger(t *testing.T) {
+func TestCurrencyFormat(t *testing.T) {
+	grouped := Currency{Code: "XTS", Symbol: "T", MinorUnits: 2, Decimal: ",", Grouping: "."}
 	tests := []struct {
 		name     string
-		f        float64
-		epsilon  float64
-		expected bool
+		currency Currency
+		units    int64
+		amount   string
+		printed  string
 	}{
-		{"exact integer", 5.0, 0.01, true},
-		{"close to integer", 5.001, 0.01, true},
-		{"not close enough", 5.02, 0.01, false},
-		{"negative close", -3.001, 0.01, true},
-		{"decimal", 3.14, 0.01, false},
-		{"large epsilon", 5.1, 0.2, true},
-		{"zero", 0.0, 0.01, true},
+		{"pounds", GBP, 5005, "50.05", "£50.05"},
+		{"euros", EUR, 5005, "50,05", "50,05 €"},
+		{"yen", JPY, 5005, "5005", "¥5005"},
+		{"dinar", KWD, 12321, "12.321", "KD12.321"},
+		{"grouped", grouped, 123456789, "1.234.567,89", "T1.234.567,89"},
+		{"grouped small", grouped, 99999, "999,99", "T999,99"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := isEffectivelyInteger(tt.f, tt.epsilon)
-			if result != tt.expected {
-				t.Errorf("isEffectivelyInteger(%f, %f) = %v, want %v", tt.f, tt.epsilon, result, tt.expected)
+			if got := tt.currency.FormatAmount(tt.units); got != tt.amount {
+				t.Errorf("FormatAmount(%d) = %q, want %q", tt.units, got, tt.amount)
+			}
+			if got := tt.currency.Format(tt.units); got != tt.printed {
+				t.Errorf("Format(%d) = %q, want %q", tt.units, got, tt.printed)
+			}
+			if got := tt.currency.parseAmount(tt.amount); math.Abs(got-float64(tt.units)/float64(pow10(tt.currency.MinorUnits))) > 1e-9 {
+				t.Errorf("parseAmount(%q) = %v", tt.amount, got)
+			}
+		})
+	}
+
+	if _, err := ParseCurrency("eur"); err != nil {
+		t.Errorf("ParseCurrency(eur) failed: %v", err)
+	}
+	if _, err := ParseCurrency("XXX"); err == nil {
+		t.Errorf("ParseCurrency(XXX) should fail")
+	}
+	if err := (Currency{Code: "BAD", MinorUnits: 2, Decimal: ",", Grouping: ","}).Validate(); err == nil {
+		t.Errorf("Validate should reject the same grouping and decimal separator")
+	}
+}
+
+func TestRoundingRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     RoundingRule
+		value    *big.Rat
+		expected int64
+	}{
+		{"half-up exact", RoundHalfUp, big.NewRat(5, 1), 5},
+		{"half-up half", RoundHalfUp, big.NewRat(64445, 2), 32223},
+		{"half-up below half", RoundHalfUp, big.NewRat(5049, 1000), 5},
+		{"half-even half to even", RoundHalfEven, big.NewRat(64445, 2), 32222},
+		{"half-even half to odd neighbour", RoundHalfEven, big.NewRat(7, 2), 4},
+		{"half-even above half", RoundHalfEven, big.NewRat(5051, 1000), 5},
+		{"up", RoundUp, big.NewRat(5001, 1000), 6},
+		{"up exact", RoundUp, big.NewRat(5, 1), 5},
+		{"down", RoundDown, big.NewRat(5999, 1000), 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.rule.round(tt.value)
+			if result.Int64() != tt.expected {
+				t.Errorf("%s.round(%s) = %d, want %d", tt.rule, tt.value.FloatString(4), result, tt.expected)
+			}
+
+			// The lower bound of the rounded value must round to it too
+			bound, inclusive := tt.rule.lowerBound(result)
+			if inclusive && tt.rule.round(bound).Cmp(result) != 0 {
+				t.Errorf("%s.lowerBound(%d) = %s does not round back", tt.rule, result, bound.FloatString(4))
+			}
+		})
+	}
+}
+
+func TestPumpModelValidate(t *testing.T) {
+	if err := DefaultPumpModel.Validate(); err != nil {
+		t.Errorf("DefaultPumpModel.Validate() = %v", err)
+	}
+
+	bad := DefaultPumpModel
+	bad.VolumeDecimals = 9
+	if bad.Validate() == nil {
+		t.Errorf("expected error for 9 volume decimals")
+	}
+
+	bad = DefaultPumpModel
+	bad.CostRounding = "sideways"
+	if bad.Validate() == nil {
+		t.Errorf("expected error for unknown rounding rule")
+	}
+}
+
+func TestPumpModelWindow(t *testing.T) {
+	// £50.05 at 128.9p: 5004.5p..5005.5p metered, showing 38.83 litres
+	results := FindPalindromicFuelCosts(128.9, 100, 0)
+	var fill *Result
+	for i := range results {
+		if results[i].CostPounds == "50.05" {
+			fill = &results[i]
+		}
+	}
+	if fill == nil {
+		t.Fatalf("expected £50.05 at 128.9p")
+	}
+	if fill.Litres != 38.83 || fill.Type != "palindromic_decimal" {
+		t.Errorf("£50.05 at 128.9p = %+v, want 38.83 palindromic litres", *fill)
+	}
+	if math.Abs(fill.MinLitres-5004.5/128.9) > 1e-9 || math.Abs(fill.MaxLitres-5005.5/128.9) > 1e-9 {
+		t.Errorf("£50.05 window = %f..%f, want %f..%f", fill.MinLitres, fill.MaxLitres, 5004.5/128.9, 5005.5/128.9)
+	}
+
+	// Exactly 25 litres is 3222.5p, which only rounding half up shows as £32.23
+	hasWhole := func(results []Result, cost string) bool {
+		for _, result := range results {
+			if result.CostPounds == cost && result.Type == "whole" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !hasWhole(FindPalindromicFuelCosts(128.9, 100, 0), "32.23") {
+		t.Errorf("half-up pump should print 25.00 L = £32.23")
+	}
+
+	// Pricing the displayed litres: 25.00 L always costs 3222.5p, rounded
+	displayed := DefaultPumpModel
+	displayed.CostBasis = CostFromDisplayed
+	if !hasWhole(FindPalindromicFuelCosts(128.9, 100, 0, WithPumpModel(displayed)), "32.23") {
+		t.Errorf("displayed-basis half-up pump should print 25.00 L = £32.23")
+	}
+	displayed.CostRounding = RoundHalfEven
+	if hasWhole(FindPalindromicFuelCosts(128.9, 100, 0, WithPumpModel(displayed)), "32.23") {
+		t.Errorf("displayed-basis half-even pump should print 25.00 L = £32.22")
+	}
+
+	// Metering just past 25 litres still shows 25.00 L and rounds to £32.23
+	metered := DefaultPumpModel
+	metered.CostRounding = RoundHalfEven
+	metered.VolumeRounding = RoundDown
+	if !hasWhole(FindPalindromicFuelCosts(128.9, 100, 0, WithPumpModel(metered)), "32.23") {
+		t.Errorf("metered half-even pump should print 25.00 L = £32.23 just past 25 litres")
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Price
+		wantErr bool
+	}{
+		{"128.9", "128.9", false},
+		{" 128.95 ", "128.95", false},
+		{"359.9999", "359.9999", false},
+		{"175", "175", false},
+		{"128.90", "128.90", false},
+		{"0150", "150", false},
+		{"00.5", "0.5", false},
+		{"0.5", "0.5", false},
+		{"000", "", true},
+		{"", "", true},
+		{"0", "", true},
+		{"-128.9", "", true},
+		{"1.2.3", "", true},
+		{"1e2", "", true},
+		{"128.", "", true},
+		{"abc", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePrice(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrice(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePrice(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	// Every price parsed survives a round trip through JSON
+	for _, tt := range tests {
+		price, err := ParsePrice(tt.input)
+		if err != nil {
+			continue
+		}
+		data, err := json.Marshal(struct{ Price Price }{price})
+		if err != nil {
+			t.Errorf("marshalling %q: %v", tt.input, err)
+			continue
+		}
+		var back struct{ Price Price }
+		if err := json.Unmarshal(data, &back); err != nil || back.Price != price {
+			t.Errorf("%q read back from %s as %q, %v", tt.input, data, back.Price, err)
+		}
+	}
+
+	// Digits beyond float64 precision still reach the search
+	s, err := newSearch("128.9000000000000000001", 0, nil)
+	if err != nil || s.price.Cmp(big.NewRat(1289, 10)) <= 0 {
+		t.Errorf("newSearch lost the trailing digits of the price")
+	}
+	if p := PriceFromFloat(128.95); p != "128.95" {
+		t.Errorf("PriceFromFloat(128.95) = %q", p)
+	}
+
+	var decoded struct{ P Price }
+	if err := json.Unmarshal([]byte(`{"P": 359.9990}`), &decoded); err != nil || decoded.P != "359.9990" {
+		t.Errorf("Unmarshal number = %q, %v", decoded.P, err)
+	}
+	if err := json.Unmarshal([]byte(`{"P": "128.95"}`), &decoded); err != nil || decoded.P != "128.95" {
+		t.Errorf("Unmarshal string = %q, %v", decoded.P, err)
+	}
+	if encoded, _ := json.Marshal(decoded); string(encoded) != `{"P":128.95}` {
+		t.Errorf("Marshal = %s", encoded)
+	}
+}
+
+func TestExactDecimal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    float64
+		expected string
+	}{
+		{"one decimal", 128.9, "1289/10"},
+		{"integer", 143, "143/1"},
+		{"two decimals", 128.95, "2579/20"},
+		{"zero", 0, "0/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := exactDecimal(tt.input)
+			if result == nil || result.String() != tt.expected {
+				t.Errorf("exactDecimal(%v) = %v, want %s", tt.input, result, tt.expected)
 			}
 		})
 	}
+
+	if exactDecimal(math.NaN()) != nil {
+		t.Errorf("exactDecimal(NaN) should be nil")
+	}
+}
+
+func TestFindPalindromicFuelCostsExact(t *testing.T) {
+	// 1001p is exactly 7 litres at 143.0p, so a zero tolerance must keep
+	// £10.01 through to £90.09 and nothing that merely rounds to a litre.
+	results := FindPalindromicFuelCosts(143.0, 100, 0)
+	whole := 0
+	for _, result := range results {
+		if result.Type == "whole" {
+			whole++
+		}
+	}
+	if whole != 9 {
+		t.Errorf("FindPalindromicFuelCosts(143.0, 100, 0) returned %d whole results, want 9", whole)
+	}
+
+	// 3223p / 128.9p is 25.0039 litres, but exactly 25 litres is 3222.5p,
+	// which the default pump rounds up to £32.23, so a receipt can print it
+	found := false
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0) {
+		if result.CostPounds == "32.23" && result.Litres == 25 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("FindPalindromicFuelCosts(128.9, 100, 0) should find 25 litres = £32.23")
+	}
+
+	// 128.8p: 25 litres is 3220p and £32.23 is 25.023 litres, too far off
+	for _, result := range FindPalindromicFuelCosts(128.8, 100, 0) {
+		if result.CostPounds == "32.23" && result.Type == "whole" {
+			t.Errorf("FindPalindromicFuelCosts(128.8, 100, 0) should not treat £32.23 as whole litres")
+		}
+	}
 }
 
 func TestGetPalindromicPencesInRange(t *testing.T) {
@@ -200,6 +562,8 @@ func TestGetPalindromicPencesInRange(t *testing.T) {
 		{"small range with palindromes", 10, 50, []int{11, 22, 33, 44}, false},
 		{"range with 1-3 digits", 1, 999, nil, true}, // just check we get results
 		{"empty range", 50, 10, nil, false},
+		{"eighteen digits", 999999999000000000, 999999999999999999, []int{999999999999999999}, false},
+		{"past the longest int palindrome", math.MaxInt - 10, math.MaxInt, nil, false},
 	}
 
 	for _, tt := range tests {
@@ -223,6 +587,31 @@ func TestGetPalindromicPencesInRange(t *testing.T) {
 	}
 }
 
+func TestPalindromesInRangeBig(t *testing.T) {
+	var got []int
+	for n := range palindromesInRangeBig(big.NewInt(1), big.NewInt(100000), 10) {
+		got = append(got, int(n.Int64()))
+	}
+	if want := getPalindromicPencesInRange(1, 100000); !reflect.DeepEqual(got, want) {
+		t.Errorf("big generator returned %d palindromes, want the same %d as the int one", len(got), len(want))
+	}
+
+	// Past int64, lazily
+	lo, _ := new(big.Int).SetString("123456789012345678901234", 10)
+	hi := new(big.Int).Mul(lo, big.NewInt(10))
+	var first []string
+	for n := range palindromesInRangeBig(lo, hi, 10) {
+		first = append(first, n.String())
+		if len(first) == 2 {
+			break
+		}
+	}
+	want := []string{"123456789013310987654321", "123456789014410987654321"}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("palindromesInRangeBig(%v, %v) started %v, want %v", lo, hi, first, want)
+	}
+}
+
 func TestFindPalindromicFuelCosts(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -277,270 +666,2779 @@ func TestFindPalindromicFuelCosts(t *testing.T) {
 	}
 }
 
-func TestFindNearestPalindromicCost(t *testing.T) {
+func TestParsePalindromeMode(t *testing.T) {
 	tests := []struct {
-		name          string
-		pricePerLitre float64
-		targetLitres  float64
-		searchRadius  int
-		expectResult  bool
+		input    string
+		expected PalindromeMode
+		wantErr  bool
 	}{
-		{"find near 25", 128.9, 25.0, 10, true},
-		{"find near 30", 128.9, 30.0, 10, true},
-		{"no result in radius", 128.9, 1000.0, 5, false},
+		{"", PalindromeLiteral, false},
+		{"literal", PalindromeLiteral, false},
+		{"Digits", PalindromeDigits, false},
+		{"symbol", PalindromeSymbol, false},
+		{"mirror", "", true},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := FindNearestPalindromicCost(tt.pricePerLitre, tt.targetLitres, tt.searchRadius, 0.01)
-			if tt.expectResult && result == nil {
-				t.Errorf("FindNearestPalindromicCost(%f, %f, %d) expected result but got nil",
-					tt.pricePerLitre, tt.targetLitres, tt.searchRadius)
-			} else if !tt.expectResult && result != nil {
-				t.Errorf("FindNearestPalindromicCost(%f, %f, %d) expected nil but got result",
-					tt.pricePerLitre, tt.targetLitres, tt.searchRadius)
+		t.Run(tt.input, func(t *testing.T) {
+			mode, err := ParsePalindromeMode(tt.input)
+			if (err != nil) != tt.wantErr || mode != tt.expected {
+				t.Errorf("ParsePalindromeMode(%q) = (%q, %v), want %q", tt.input, mode, err, tt.expected)
 			}
 		})
 	}
 }
 
-func TestFindPalindromicCostForTarget(t *testing.T) {
-	tests := []struct {
-		name              string
-		pricePerLitre     float64
-		targetPounds      float64
-		searchRadiusPence int
-		expectedCount     int
-	}{
-		{"find near £32.23", 128.9, 32.23, 100, 1},
-		{"find near £50.05", 128.9, 50.05, 100, 1},
-		{"no results in radius", 128.9, 1000.00, 10, 0},
-		{"multiple results", 128.9, 50.00, 500, 2}, // Should find both 32.23 and 50.05
-	}
+func TestSymbolPalindromesInRange(t *testing.T) {
+	for _, c := range []Currency{GBP, EUR} {
+		var want []int64
+		for n := int64(1); n < 30000; n++ {
+			if PalindromeSymbol.matchesCost(c.FormatAmount(n), c) {
+				want = append(want, n)
+			}
+		}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			results := FindPalindromicCostForTarget(tt.pricePerLitre, tt.targetPounds, tt.searchRadiusPence, 0.01)
-			if len(results) != tt.expectedCount {
-				t.Errorf("FindPalindromicCostForTarget(%f, %f, %d) returned %d results, want %d",
-					tt.pricePerLitre, tt.targetPounds, tt.searchRadiusPence, len(results), tt.expectedCount)
+		for _, lo := range []int64{1, 100, 1234, 20000} {
+			got := make(map[int64]bool)
+			var last int64
+			for n := range symbolPalindromesInRangeBig(big.NewInt(lo), big.NewInt(29999), c.SymbolAfter) {
+				if n.Int64() <= last {
+					t.Fatalf("%s from %d: %d came after %d", c.Code, lo, n, last)
+				}
+				last = n.Int64()
+				got[last] = true
 			}
-		})
+			for _, n := range want {
+				if n >= lo && !got[n] {
+					t.Errorf("%s from %d: missed %s", c.Code, lo, c.Format(n))
+				}
+			}
+		}
 	}
 }
 
-func TestBatchFindPalindromicCosts(t *testing.T) {
+func TestPalindromeModeMatchesCost(t *testing.T) {
 	tests := []struct {
-		name         string
-		prices       []float64
-		maxLitres    int
-		expectedKeys int
+		name     string
+		mode     PalindromeMode
+		pence    int
+		expected bool
 	}{
-		{"single price", []float64{128.9}, 100, 1},
-		{"multiple prices", []float64{128.9, 135.7}, 50, 2},
-		{"empty prices", []float64{}, 100, 0},
+		{"literal 50.05", PalindromeLiteral, 5005, true},
+		{"literal 123.21", PalindromeLiteral, 12321, false},
+		{"digits 123.21", PalindromeDigits, 12321, true},
+		{"digits 50.05", PalindromeDigits, 5005, true},
+		{"digits 5.05", PalindromeDigits, 505, true},
+		{"digits 0.50", PalindromeDigits, 50, true},
+		{"digits 32.14", PalindromeDigits, 3214, false},
+		{"symbol 12.13", PalindromeSymbol, 1213, true},
+		{"symbol 1.21", PalindromeSymbol, 121, false},
+		{"symbol 50.05", PalindromeSymbol, 5005, false},
+		{"symbol 5.50", PalindromeSymbol, 550, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			results := BatchFindPalindromicCosts(tt.prices, tt.maxLitres, 0.01)
-			if len(results) != tt.expectedKeys {
-				t.Errorf("BatchFindPalindromicCosts(%v, %d) returned %d results, want %d keys",
-					tt.prices, tt.maxLitres, len(results), tt.expectedKeys)
+			if result := tt.mode.matchesCost(formatPounds(tt.pence), GBP); result != tt.expected {
+				t.Errorf("%s.matchesCost(%d) = %v, want %v", tt.mode, tt.pence, result, tt.expected)
 			}
+		})
+	}
+}
 
-			// Verify each price has results
-			for _, price := range tt.prices {
-				if _, exists := results[price]; !exists {
-					t.Errorf("BatchFindPalindromicCosts missing results for price %f", price)
-				}
+func TestFindPalindromicFuelCostsDigitsMode(t *testing.T) {
+	// 100 litres at 123.21p is £123.21, which only the digits mode accepts
+	hasFill := func(results []Result) bool {
+		for _, result := range results {
+			if result.CostPounds == "123.21" && result.Litres == 100 {
+				return true
 			}
-		})
+		}
+		return false
+	}
+
+	if hasFill(FindPalindromicFuelCosts(123.21, 200, 0)) {
+		t.Errorf("literal mode should not find £123.21")
+	}
+	if !hasFill(FindPalindromicFuelCosts(123.21, 200, 0, WithPalindromeMode(PalindromeDigits))) {
+		t.Errorf("digits mode should find 100 litres = £123.21")
+	}
+
+	literal := FindPalindromicFuelCosts(128.9, 1000, 0.01)
+	digits := FindPalindromicFuelCosts(128.9, 1000, 0.01, WithPalindromeMode(PalindromeDigits))
+	if len(digits) <= len(literal) {
+		t.Errorf("digits mode found %d results, want more than literal's %d", len(digits), len(literal))
 	}
 }
 
-func TestPrintResult(t *testing.T) {
+func TestNumberPatterns(t *testing.T) {
 	tests := []struct {
-		name   string
-		result Result
+		name       string
+		pattern    NumberPattern
+		lo, hi     int
+		candidates []int
+		matches    []string
+		rejects    []string
 	}{
-		{"whole number litres", Result{
-			Litres:             25.0,
-			CostPounds:         "32.23",
-			LitresIsPalindrome: false,
-			Type:               "whole",
-		}},
-		{"palindromic whole litres", Result{
-			Litres:             121.0,
-			CostPounds:         "50.05",
-			LitresIsPalindrome: true,
-			Type:               "whole",
-		}},
-		{"palindromic decimal litres", Result{
-			Litres:             38.83,
-			CostPounds:         "50.05",
-			LitresIsPalindrome: true,
-			Type:               "palindromic_decimal",
-		}},
-		{"decimal litres", Result{
-			Litres:             15.75,
-			CostPounds:         "20.31",
-			LitresIsPalindrome: false,
-			Type:               "whole",
-		}},
+		{"palindrome", PalindromePattern{Mode: PalindromeLiteral}, 5000, 5200, []int{5005, 5115}, []string{"50.05"}, []string{"51.15x", "123.21"}},
+		{"repdigit", RepdigitPattern{}, 100, 5000, []int{111, 222, 333, 444, 555, 666, 777, 888, 999, 1111, 2222, 3333, 4444}, []string{"44.44", "3.33"}, []string{"44.45", "4"}},
+		{"ascending", RunPattern{}, 100, 2000, []int{123, 234, 345, 456, 567, 678, 789, 1234}, []string{"12.34", "4.56"}, []string{"12.35", "43.21"}},
+		{"descending", RunPattern{Descending: true}, 100, 1000, []int{210, 321, 432, 543, 654, 765, 876, 987}, []string{"43.21", "9.87", "3.21"}, []string{"12.34"}},
+		{"round", RoundPattern{}, 150, 450, []int{200, 300, 400}, []string{"50.00", "3"}, []string{"50.05"}},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Test that it doesn't panic
-			printResult(tt.result)
+			if result := tt.pattern.Candidates(tt.lo, tt.hi, 2); !reflect.DeepEqual(result, tt.candidates) {
+				t.Errorf("%s.Candidates(%d, %d) = %v, want %v", tt.name, tt.lo, tt.hi, result, tt.candidates)
+			}
+			for _, s := range tt.matches {
+				if !tt.pattern.Matches(s) {
+					t.Errorf("%s.Matches(%q) = false, want true", tt.name, s)
+				}
+			}
+			for _, s := range tt.rejects {
+				if tt.pattern.Matches(s) {
+					t.Errorf("%s.Matches(%q) = true, want false", tt.name, s)
+				}
+			}
 		})
 	}
+
+	if !(ReversedPattern{}).MatchesPair("12.34", "43.21") || (ReversedPattern{}).MatchesPair("12.34", "12.34") {
+		t.Errorf("ReversedPattern.MatchesPair should require litres to be the cost reversed")
+	}
 }
 
-func TestPrintResults(t *testing.T) {
+func TestParsePatternInBase(t *testing.T) {
+	pattern, err := ParsePatternInBase("palindrome", PalindromeDigits, 16)
+	if err != nil || pattern != (PalindromePattern{Mode: PalindromeDigits, Base: 16}) {
+		t.Errorf("ParsePatternInBase(palindrome, 16) = %v, %v", pattern, err)
+	}
+	if pattern, err := ParsePatternInBase("round", PalindromeLiteral, 0); err != nil || pattern != (RoundPattern{}) {
+		t.Errorf("ParsePatternInBase(round, 0) = %v, %v", pattern, err)
+	}
+	for _, tt := range []struct {
+		name string
+		base int
+	}{{"palindrome", 1}, {"palindrome", 37}, {"round", 2}} {
+		if _, err := ParsePatternInBase(tt.name, PalindromeLiteral, tt.base); err == nil {
+			t.Errorf("ParsePatternInBase(%s, %d) should fail", tt.name, tt.base)
+		}
+	}
+}
+
+func TestFindInBase(t *testing.T) {
+	results := FindPalindromicFuelCosts(128.9, 100, 0, WithPattern(PalindromePattern{Base: 2}))
+	if len(results) == 0 {
+		t.Fatal("expected binary palindromes")
+	}
+	for _, result := range results {
+		units, _ := strconv.Atoi(digitsOnly(result.CostPounds))
+		if result.Base != 2 || result.Representation != strconv.FormatInt(int64(units), 2) || !isPalindromeString(result.Representation) {
+			t.Errorf("£%s reported as %q in base %d", result.CostPounds, result.Representation, result.Base)
+		}
+	}
+	// £1.29 is 129p, 10000001 in binary
+	if results[0].CostPounds != "1.29" || results[0].Representation != "10000001" {
+		t.Errorf("first binary result = %+v", results[0])
+	}
+
+	if results := FindPalindromicFuelCosts(128.9, 100, 0); results[0].Base != 0 || results[0].Representation != "" {
+		t.Errorf("base ten results should carry no representation, got %+v", results[0])
+	}
+	if err := ValidateSearch("128.9", 100, 0, WithPattern(PalindromePattern{Base: 40})); err == nil {
+		t.Error("ValidateSearch should reject base 40")
+	}
+}
+
+func TestFindWithPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		cost    string
+		litres  float64
+	}{
+		{"round", "round", "58.00", 45},
+		{"descending", "descending", "87.65", 68},
+		{"reversed", "reversed", "32.52", 25.23},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := ParsePattern(tt.pattern, PalindromeLiteral)
+			if err != nil {
+				t.Fatalf("ParsePattern(%q) failed: %v", tt.pattern, err)
+			}
+
+			found := false
+			for _, result := range FindPalindromicFuelCosts(128.9, 200, 0, WithPattern(pattern)) {
+				if !pattern.Matches(result.CostPounds) || result.Pattern != tt.pattern {
+					t.Errorf("result %+v does not match pattern %s", result, tt.pattern)
+				}
+				if result.CostPounds == tt.cost && result.Litres == tt.litres {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("pattern %s at 128.9p did not find %.2f litres = £%s", tt.pattern, tt.litres, tt.cost)
+			}
+		})
+	}
+
+	if _, err := ParsePattern("fibonacci", PalindromeLiteral); err == nil {
+		t.Errorf("ParsePattern(\"fibonacci\") expected error")
+	}
+}
+
+func TestFindPalindromicFuelCostsCurrency(t *testing.T) {
+	find := func(results []Result, cost string, litres float64) bool {
+		for _, result := range results {
+			if result.CostPounds == cost && result.Litres == litres {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 150 cents a litre: 20.02 litres cost 30,03 €, a palindrome around the comma
+	euros := FindPalindromicFuelCosts(150, 100, 0, WithCurrency(EUR))
+	if !find(euros, "30,03", 20.02) {
+		t.Errorf("expected 20.02 litres = 30,03 €, got %+v", euros)
+	}
+	for _, result := range euros {
+		if result.Currency != "EUR" {
+			t.Errorf("result currency = %q, want EUR", result.Currency)
+		}
+	}
+
+	// Yen have no minor unit, so the whole amount must read backwards
+	yen := FindPalindromicFuelCosts(175, 60, 0, WithCurrency(JPY))
+	if !find(yen, "525", 3) {
+		t.Errorf("expected 3 litres = ¥525, got %+v", yen)
+	}
+
+	// Dinar totals have three decimals, so 4.004 needs digits mode
+	dinar := FindPalindromicFuelCosts(1001, 10, 0, WithCurrency(KWD))
+	if find(dinar, "4.004", 4) {
+		t.Errorf("literal mode should not accept KD4.004")
+	}
+	dinar = FindPalindromicFuelCosts(1001, 10, 0, WithCurrency(KWD), WithPalindromeMode(PalindromeDigits))
+	if !find(dinar, "4.004", 4) {
+		t.Errorf("expected 4 litres = KD4.004 in digits mode, got %+v", dinar)
+	}
+
+	// A symbol after the amount pairs with the first digit, so 10,50 €
+	// (1050 €) qualifies for 7 litres at 150c
+	euros = FindPalindromicFuelCosts(150, 100, 0, WithCurrency(EUR), WithPalindromeMode(PalindromeSymbol))
+	if !find(euros, "10,50", 7) {
+		t.Errorf("expected 7 litres = 10,50 € in symbol mode, got %+v", euros)
+	}
+	for _, result := range euros {
+		if digits := digitsOnly(result.CostPounds); !isPalindromeString(digits[1:]) {
+			t.Errorf("%s € isn't a palindrome with the symbol after it", result.CostPounds)
+		}
+	}
+
+	invalid := Currency{Code: "BAD", MinorUnits: 9, Decimal: "."}
+	if results := FindPalindromicFuelCosts(150, 100, 0, WithCurrency(invalid)); len(results) != 0 {
+		t.Errorf("invalid currency returned %d results", len(results))
+	}
+}
+
+func TestFindPalindromicFuelCostsGallons(t *testing.T) {
+	opts := []Option{WithCurrency(USD), WithVolumeUnit(USGallons), WithPalindromeMode(PalindromeDigits)}
+	results := FindPalindromicFuelCosts(359.9, 30, 0, opts...)
+
+	var found *Result
+	for i := range results {
+		if results[i].CostPounds == "14.41" {
+			found = &results[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("expected 4.004 gallons = $14.41, got %+v", results)
+	}
+	// US pumps show gallons to three decimals, and the volume is checked there
+	if found.Volume != "4.004" || found.Litres != 4.004 || found.Unit != "us-gallons" {
+		t.Errorf("got %+v, want 4.004 us-gallons", *found)
+	}
+	// One cent buys 1/359.9 of a gallon, about 10.5 ml
+	if math.Abs(found.WindowMl-3785.411784/359.9) > 1e-9 {
+		t.Errorf("WindowMl = %v, want %v", found.WindowMl, 3785.411784/359.9)
+	}
+
+	// An explicit pump precision still wins over the unit's usual one
+	pump := DefaultPumpModel
+	pump.VolumeDecimals = 2
+	for _, result := range FindPalindromicFuelCosts(359.9, 30, 0, append(opts, WithPumpModel(pump))...) {
+		if len(result.Volume) > 0 && strings.Index(result.Volume, ".") != len(result.Volume)-3 {
+			t.Errorf("volume %q not shown to 2 decimals", result.Volume)
+		}
+	}
+
+	if _, err := ParseVolumeUnit("imperial-gallons"); err != nil {
+		t.Errorf("ParseVolumeUnit(imperial-gallons) failed: %v", err)
+	}
+	if _, err := ParseVolumeUnit("barrels"); err == nil {
+		t.Errorf("ParseVolumeUnit(barrels) should fail")
+	}
+}
+
+func TestStreamPalindromicFuelCosts(t *testing.T) {
+	want := FindPalindromicFuelCosts(128.9, 1000, 0)
+	got := slices.Collect(StreamPalindromicFuelCosts(context.Background(), "128.9", 1000, 0))
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("stream returned %d results, want the same %d as FindPalindromicFuelCosts", len(got), len(want))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Litres < got[i-1].Litres {
+			t.Errorf("results out of litre order: %v before %v", got[i-1].Litres, got[i].Litres)
+		}
+	}
+
+	// Stopping early ends the search
+	count := 0
+	for range StreamPalindromicFuelCosts(context.Background(), "128.9", 1000, 0) {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("expected to stop after 2 results, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results := slices.Collect(StreamPalindromicFuelCosts(ctx, "128.9", 1000, 0)); len(results) != 0 {
+		t.Errorf("cancelled stream returned %d results", len(results))
+	}
+}
+
+func TestStreamPalindromicFuelCostsHugeRange(t *testing.T) {
+	// The most expensive fill costs far more than an int can count
+	var got []Result
+	for result := range StreamPalindromicFuelCosts(context.Background(), "128.9", math.MaxInt, 0, WithPattern(PalindromePattern{Mode: PalindromeDigits})) {
+		got = append(got, result)
+		if len(got) == 3 {
+			break
+		}
+	}
+	want := FindPalindromicFuelCostsAt("128.9", 10, 0, WithPattern(PalindromePattern{Mode: PalindromeDigits}))
+	if len(got) != 3 || len(want) < 3 || !reflect.DeepEqual(got, want[:3]) {
+		t.Errorf("huge range started with %v, want %v", got, want)
+	}
+
+	// Dense patterns check every candidate, so a huge range with no budget
+	// is rejected rather than generated
+	for range StreamPalindromicFuelCosts(context.Background(), "128.9", 100000000, 0, WithPattern(ReversedPattern{})) {
+		t.Errorf("reversed search of 100 million litres returned results")
+		break
+	}
+
+	// Long costs are walked one at a time rather than generated up front
+	var amounts []string
+	for n := range (ReversedPattern{}).CandidatesBig(big.NewInt(1e11), big.NewInt(1e12-1), 2) {
+		amounts = append(amounts, n.String())
+		if len(amounts) == 2 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(amounts, []string{"100000000000", "100000000001"}) {
+		t.Errorf("reversed candidates started with %v", amounts)
+	}
+
+	// A price beyond int64 still prices whole litres
+	results := FindPalindromicFuelCostsAt("100000000000000000000", 1, 0, WithPattern(RoundPattern{}))
+	if len(results) != 1 || results[0].CostPounds != "1000000000000000000.00" || results[0].Volume != "1.00" {
+		t.Errorf("huge price returned %v, want one litre for 1000000000000000000.00", results)
+	}
+}
+
+func TestValidateSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		price     Price
+		maxLitres int
+		opts      []Option
+		wantErr   bool
+	}{
+		{"valid", "128.9", 100, nil, false},
+		{"huge range, palindromes", "128.9", math.MaxInt, nil, false},
+		{"huge range, reversed", "128.9", math.MaxInt, []Option{WithPattern(ReversedPattern{})}, true},
+		{"reversed within int", "128.9", 1000, []Option{WithPattern(ReversedPattern{})}, false},
+		{"reversed past what it can walk", "128.9", 100000000, []Option{WithPattern(ReversedPattern{})}, true},
+		{"huge range, round", "128.9", math.MaxInt, []Option{WithPattern(RoundPattern{})}, true},
+		{"round within limit", "128.9", 1000000, []Option{WithPattern(RoundPattern{})}, false},
+		{"no volume", "128.9", 0, nil, true},
+		{"zero price", "0", 100, nil, true},
+		{"negative price", "-1", 100, nil, true},
+		{"bad pump", "128.9", 100, []Option{WithPumpModel(PumpModel{VolumeDecimals: -2})}, true},
+		{"budget", "128.9", 100, []Option{WithBudget(Budget{Min: 40, Max: 60})}, false},
+		{"huge range, reversed within budget", "128.9", math.MaxInt, []Option{WithPattern(ReversedPattern{}), WithBudget(Budget{Max: 1000})}, false},
+		{"budget beyond max volume", "128.9", 100, []Option{WithBudget(Budget{Min: 200})}, true},
+		{"budget under a litre", "128.9", 100, []Option{WithBudget(Budget{Max: 1})}, true},
+		{"budget upside down", "128.9", 100, []Option{WithBudget(Budget{Min: 60, Max: 40})}, true},
+		{"negative budget", "128.9", 100, []Option{WithBudget(Budget{Min: -1})}, true},
+		{"infinite minimum spend", "128.9", 100, []Option{WithBudget(Budget{Min: math.Inf(1)})}, true},
+		{"infinite maximum spend", "128.9", 100, []Option{WithBudget(Budget{Max: math.Inf(1)})}, true},
+		{"NaN budget", "128.9", 100, []Option{WithBudget(Budget{Max: math.NaN()})}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSearch(tt.price, tt.maxLitres, 0, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSearch(%q, %d) error = %v, wantErr %v", tt.price, tt.maxLitres, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindWithBudget(t *testing.T) {
+	budget := Budget{Min: 40, Max: 60}
+	var want []Result
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0) {
+		if cost, _ := strconv.ParseFloat(result.CostPounds, 64); cost >= budget.Min && cost <= budget.Max {
+			want = append(want, result)
+		}
+	}
+	if len(want) == 0 {
+		t.Fatal("expected some costs between £40 and £60")
+	}
+	if got := FindPalindromicFuelCosts(128.9, 100, 0, WithBudget(budget)); !reflect.DeepEqual(got, want) {
+		t.Errorf("budget found %+v, want %+v", got, want)
+	}
+
+	// Limits on the exact penny are included
+	if got := FindPalindromicFuelCosts(128.9, 100, 0, WithBudget(Budget{Min: 50.05, Max: 50.05})); len(got) != 1 || got[0].CostPounds != "50.05" {
+		t.Errorf("budget of exactly £50.05 found %+v", got)
+	}
+	if got := FindPalindromicFuelCosts(128.9, 100, 0, WithBudget(Budget{Min: 50.06})); len(got) == 0 || got[0].CostPounds == "50.05" {
+		t.Errorf("open-ended budget from £50.06 found %+v", got)
+	}
+
+	for _, result := range FindPalindromicCostForTarget(128.9, 50, 1000, 0, WithBudget(Budget{Max: 52})) {
+		if cost, _ := strconv.ParseFloat(result.CostPounds, 64); cost > 52 {
+			t.Errorf("near £50 with a £52 budget found %s", result.CostPounds)
+		}
+	}
+	if got := FindPricesForCost(50.05, 125, 130, 0.1, 0, WithBudget(Budget{Max: 50})); len(got) != 0 {
+		t.Errorf("£50.05 is over a £50 budget, but found %+v", got)
+	}
+}
+
+func TestDiscountValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		discount Discount
+		wantErr  bool
+	}{
+		{"none", Discount{}, false},
+		{"5p a litre", Discount{PerUnit: 5}, false},
+		{"£2 off over £40", Discount{Fixed: 2, Threshold: 40}, false},
+		{"everything", Discount{PerUnit: 3, Percent: 2, Fixed: 1, Threshold: 30}, false},
+		{"negative", Discount{Fixed: -2}, true},
+		{"all of it", Discount{Percent: 100}, true},
+		{"NaN percent", Discount{Percent: math.NaN()}, true},
+		{"NaN per litre", Discount{PerUnit: math.NaN()}, true},
+		{"infinite fixed", Discount{Fixed: math.Inf(1)}, true},
+		{"infinite threshold", Discount{Threshold: math.Inf(1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.discount.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := ValidateSearch("128.9", 100, 0, WithDiscount(Discount{PerUnit: 128.9})); err == nil {
+		t.Error("accepted a per litre discount as big as the price")
+	}
+	if err := ValidateSearch("128.9", 100, 0, WithDiscount(Discount{PerUnit: 70, Percent: 50})); err == nil {
+		t.Error("accepted a percentage and per litre discount that take off the whole price")
+	}
+	if err := ValidateSearch("128.9", 100, 0, WithDiscount(Discount{PerUnit: 60, Percent: 50})); err != nil {
+		t.Errorf("rejected a discount that leaves some of the price: %v", err)
+	}
+}
+
+func TestFindWithDiscount(t *testing.T) {
+	// Found by hand: 41.54 at the pump is 32.23 litres, less 5p each
+	results := FindPalindromicFuelCosts(128.9, 100, 0, WithDiscount(Discount{PerUnit: 5}))
+	if len(results) == 0 || results[0].CostPounds != "39.93" || results[0].PumpPounds != "41.54" || results[0].DiscountPounds != "1.61" {
+		t.Fatalf("5p a litre off found %+v, want £41.54 at the pump for £39.93", results)
+	}
+
+	// Under the threshold the pump total is the receipt total
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0, WithDiscount(Discount{Fixed: 2, Threshold: 40})) {
+		pump, _ := strconv.ParseFloat(result.PumpPounds, 64)
+		cost, _ := strconv.ParseFloat(result.CostPounds, 64)
+		want := pump
+		if pump >= 40 {
+			want -= 2
+		}
+		if math.Abs(cost-want) > 1e-9 || !isPalindromeString(result.CostPounds) {
+			t.Errorf("£2 off over £40 turned %s into %s", result.PumpPounds, result.CostPounds)
+		}
+		if result.PumpMatches != isPalindromeString(result.PumpPounds) {
+			t.Errorf("PumpMatches = %v for %s", result.PumpMatches, result.PumpPounds)
+		}
+	}
+
+	// Every pump total, every litre reading: the search misses nothing
+	for _, discount := range []Discount{{PerUnit: 5}, {Percent: 3}, {PerUnit: 7, Percent: 2, Fixed: 1.5, Threshold: 30}} {
+		opts := []Option{WithDiscount(discount), WithPalindromeMode(PalindromeDigits)}
+		got := make(map[string]string)
+		for _, result := range FindPalindromicFuelCosts(128.9, 100, 0, opts...) {
+			got[result.PumpPounds+" "+result.Volume] = result.CostPounds
+		}
+
+		s, _ := newSearch("128.9", 0, opts)
+		want := make(map[string]string)
+		_, maxUnits := s.costUnitsRange(100)
+		for units := big.NewInt(1); units.Cmp(maxUnits) <= 0; units = new(big.Int).Add(units, big.NewInt(1)) {
+			w, ok := s.window(units)
+			if !ok {
+				continue
+			}
+			for step := new(big.Int).Set(w.minStep); step.Cmp(w.maxStep) <= 0; step.Add(step, big.NewInt(1)) {
+				receipt := s.receipt(units, new(big.Rat).SetFrac(step, big.NewInt(s.volumeScale)))
+				if !s.pattern.Matches(s.formatCost(receipt)) {
+					continue
+				}
+				if result, ok := s.evaluate(units, w, receipt); ok && result.Litres <= 100 {
+					want[result.PumpPounds+" "+result.Volume] = result.CostPounds
+				}
+			}
+		}
+
+		if len(want) == 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: found %v, want %v", discount, got, want)
+		}
+	}
+}
+
+func TestParseExtra(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Extra
+		wantErr bool
+	}{
+		{"wash=6.50", Extra{Name: "wash", Price: 6.5}, false},
+		{" coffee = 3.2 ", Extra{Name: "coffee", Price: 3.2}, false},
+		{"wash", Extra{}, true},
+		{"=6.50", Extra{}, true},
+		{"wash=free", Extra{}, true},
+		{"wash=0", Extra{}, true},
+		{"wash=-6.50", Extra{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseExtra(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExtra(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseExtra(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	if got := (Extra{Name: "wash", Price: 6.5}).String(); got != "wash=6.5" {
+		t.Errorf("String() = %q, want wash=6.5", got)
+	}
+}
+
+func TestFindWithExtras(t *testing.T) {
+	// Found by hand: 8 litres comes to £10.32, and a £9.70 basket makes £20.02
+	results := FindPalindromicFuelCosts(128.9, 100, 0, WithExtras(Extra{"wash", 6.5}, Extra{"coffee", 3.2}))
+	if len(results) == 0 || results[0].CostPounds != "20.02" || results[0].PumpPounds != "10.32" || results[0].ExtrasPounds != "9.70" {
+		t.Fatalf("£9.70 of extras found %+v, want £10.32 at the pump for £20.02", results)
+	}
+	for _, result := range results {
+		pump, _ := strconv.ParseFloat(result.PumpPounds, 64)
+		cost, _ := strconv.ParseFloat(result.CostPounds, 64)
+		if math.Abs(cost-pump-9.7) > 1e-9 || !isPalindromeString(result.CostPounds) {
+			t.Errorf("£9.70 of extras turned %s into %s", result.PumpPounds, result.CostPounds)
+		}
+		if result.DiscountPounds != "" {
+			t.Errorf("%+v has a discount without one", result)
+		}
+	}
+
+	// Extras go on after the discount, which only sees the fuel
+	opts := []Option{WithExtras(Extra{"wash", 6.5}), WithDiscount(Discount{Fixed: 2, Threshold: 40}), WithPalindromeMode(PalindromeDigits)}
+	got := make(map[string]string)
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0, opts...) {
+		got[result.PumpPounds+" "+result.Volume] = result.CostPounds
+	}
+
+	s, _ := newSearch("128.9", 0, opts)
+	want := make(map[string]string)
+	_, maxUnits := s.costUnitsRange(100)
+	for units := big.NewInt(1); units.Cmp(maxUnits) <= 0; units = new(big.Int).Add(units, big.NewInt(1)) {
+		w, ok := s.window(units)
+		if !ok {
+			continue
+		}
+		for step := new(big.Int).Set(w.minStep); step.Cmp(w.maxStep) <= 0; step.Add(step, big.NewInt(1)) {
+			receipt := s.receipt(units, new(big.Rat).SetFrac(step, big.NewInt(s.volumeScale)))
+			if !s.pattern.Matches(s.formatCost(receipt)) {
+				continue
+			}
+			if result, ok := s.evaluate(units, w, receipt); ok && result.Litres <= 100 {
+				want[result.PumpPounds+" "+result.Volume] = result.CostPounds
+			}
+		}
+	}
+
+	if len(want) == 0 || !reflect.DeepEqual(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+
+	if err := ValidateSearch("128.9", 100, 0, WithExtras(Extra{"wash", 6.5}), WithBudget(Budget{Max: 5})); err == nil {
+		t.Error("accepted a maximum spend below the price of the extras")
+	}
+}
+
+func TestVATSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		vat     VAT
+		gross   int64
+		wantNet int64
+		wantVAT int64
+	}{
+		{"a sixth", VAT{Rate: 20}, 3223, 2686, 537},
+		{"half a penny rounds up", VAT{Rate: 20}, 5445, 4537, 908},
+		{"rounded down", VAT{Rate: 20, Rounding: RoundDown}, 5445, 4538, 907},
+		{"reduced rate", VAT{Rate: 5}, 1050, 1000, 50},
+		{"exact", VAT{Rate: 20}, 6000, 5000, 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			net, vat := tt.vat.split(big.NewInt(tt.gross))
+			if net.Int64() != tt.wantNet || vat.Int64() != tt.wantVAT {
+				t.Errorf("split(%d) = %v + %v, want %d + %d", tt.gross, net, vat, tt.wantNet, tt.wantVAT)
+			}
+		})
+	}
+
+	for _, vat := range []VAT{{Rate: -1}, {Rate: 101}, {Rate: math.NaN()}, {Rate: 20, Rounding: "sideways"}} {
+		if err := vat.Validate(); err == nil {
+			t.Errorf("Validate() accepted %+v", vat)
+		}
+	}
+}
+
+func TestFindWithVAT(t *testing.T) {
+	results := FindPalindromicFuelCosts(128.9, 100, 0, WithVAT(VAT{Rate: 20}))
+	if len(results) == 0 {
+		t.Fatal("expected results")
+	}
+	for _, result := range results {
+		cost, _ := strconv.ParseFloat(result.CostPounds, 64)
+		net, _ := strconv.ParseFloat(result.NetPounds, 64)
+		vat, _ := strconv.ParseFloat(result.VATPounds, 64)
+		if math.Abs(net+vat-cost) > 1e-9 || math.Abs(vat-math.Round(cost*100/6)/100) > 1e-9 {
+			t.Errorf("£%s split into net £%s and VAT £%s", result.CostPounds, result.NetPounds, result.VATPounds)
+		}
+	}
+
+	// Found by hand: £1.81 is £1.51 net and 30p VAT, all palindromes as digits
+	results = FindPalindromicFuelCosts(128.9, 2, 0, WithVAT(VAT{Rate: 20}), WithPalindromeMode(PalindromeDigits))
+	found := false
+	for _, result := range results {
+		if result.CostPounds == "1.81" {
+			found = result.NetPounds == "1.51" && result.VATPounds == "0.30" && result.NetMatches && result.VATMatches
+		}
+	}
+	if !found {
+		t.Errorf("expected £1.81 flagged with a palindromic net and VAT, got %+v", results)
+	}
+
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0) {
+		if result.VATPounds != "" || result.NetPounds != "" {
+			t.Errorf("%+v has VAT lines without a VAT rate", result)
+		}
+	}
+}
+
+func TestFillModeUnit(t *testing.T) {
+	tests := []struct {
+		mode     string
+		unit     string
+		wantUnit VolumeUnit
+		wantErr  bool
+	}{
+		{"", "", Litres, false},
+		{"fuel", "us-gallons", USGallons, false},
+		{"fuel", "kwh", KilowattHours, false},
+		{"ev", "", KilowattHours, false},
+		{"EV", "kwh", KilowattHours, false},
+		{"ev", "litres", VolumeUnit{}, true},
+		{"hybrid", "", VolumeUnit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.unit, func(t *testing.T) {
+			mode, err := ParseFillMode(tt.mode)
+			var unit VolumeUnit
+			if err == nil {
+				unit, err = mode.Unit(tt.unit)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if unit != tt.wantUnit {
+				t.Errorf("unit = %+v, want %+v", unit, tt.wantUnit)
+			}
+		})
+	}
+
+	for input, want := range map[string]MatchTarget{"": MatchTotal, "volume": MatchVolume, "Both": MatchBoth} {
+		if got, err := ParseMatchTarget(input); err != nil || got != want {
+			t.Errorf("ParseMatchTarget(%q) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseMatchTarget("sideways"); err == nil {
+		t.Error("ParseMatchTarget accepted an unknown target")
+	}
+}
+
+func TestFindWithChargingFees(t *testing.T) {
+	// Found by hand: 98 kWh at 79p is £77.42, and a 35p session fee makes £77.77
+	results := FindPalindromicFuelCosts(79, 100, 0, WithVolumeUnit(KilowattHours), WithChargingFees(ChargingFees{Session: 0.35}))
+	if len(results) == 0 || results[0].CostPounds != "77.77" || results[0].PumpPounds != "77.42" || results[0].FeesPounds != "0.35" {
+		t.Fatalf("35p session fee found %+v, want £77.42 at the charger for £77.77", results)
+	}
+	if results[0].Unit != "kwh" || results[0].WindowMl != 12.658227848101266 {
+		t.Errorf("expected a stop window in Wh, got %+v", results[0])
+	}
+
+	for _, fees := range []ChargingFees{{Session: -0.35}, {Idle: math.Inf(1)}} {
+		if err := fees.Validate(); err == nil {
+			t.Errorf("Validate() accepted %+v", fees)
+		}
+	}
+	if err := ValidateSearch("128.9", 100, 0, WithChargingFees(ChargingFees{Session: 1})); err == nil {
+		t.Error("accepted charging fees for litres of fuel")
+	}
+}
+
+func TestFindWithMatch(t *testing.T) {
+	opts := []Option{WithVolumeUnit(KilowattHours), WithMatch(MatchVolume)}
+	results := FindPalindromicFuelCosts(79, 40, 0, opts...)
+	volumes := make(map[string]bool)
+	for _, result := range results {
+		volumes[formatResultVolume(result)] = true
+		if !isPalindromeString(formatResultVolume(result)) {
+			t.Errorf("%s kWh is not a palindrome", formatResultVolume(result))
+		}
+
+		// The middle of the window shows this reading and this total
+		mid := (result.MinLitres + result.MaxLitres) / 2
+		if strconv.FormatFloat(mid, 'f', 2, 64) != strconv.FormatFloat(result.Litres, 'f', 2, 64) || strconv.FormatFloat(math.Round(mid*79)/100, 'f', 2, 64) != result.CostPounds {
+			t.Errorf("%s kWh = £%s, but the middle of its window is %.4f kWh", result.Volume, result.CostPounds, mid)
+		}
+		if (result.Pattern == "palindrome") != isPalindromeString(result.CostPounds) {
+			t.Errorf("£%s has pattern %q", result.CostPounds, result.Pattern)
+		}
+	}
+	for _, want := range []string{"1", "9", "11", "10.01", "11.11", "33.33"} {
+		if !volumes[want] {
+			t.Errorf("expected %s kWh among %v", want, volumes)
+		}
+	}
+
+	// Both is the totals whose volumes match too
+	var want []Result
+	for _, result := range FindPalindromicFuelCosts(79, 200, 0, WithVolumeUnit(KilowattHours)) {
+		if isPalindromeString(formatResultVolume(result)) {
+			want = append(want, result)
+		}
+	}
+	got := FindPalindromicFuelCosts(79, 200, 0, WithVolumeUnit(KilowattHours), WithMatch(MatchBoth))
+	if len(want) == 0 || !reflect.DeepEqual(got, want) {
+		t.Errorf("both found %+v, want %+v", got, want)
+	}
+
+	if err := ValidateSearch("128.9", 100, 0, WithPattern(ReversedPattern{}), WithMatch(MatchVolume)); err == nil {
+		t.Error("accepted a paired pattern for volumes alone")
+	}
+
+	// Volumes are stepped through one at a time, so huge ranges are rejected
+	// rather than left to run for hours or overflow
+	for _, max := range []int{10000000, math.MaxInt} {
+		if err := ValidateSearch("79", max, 0, WithVolumeUnit(KilowattHours), WithMatch(MatchVolume)); err == nil {
+			t.Errorf("accepted volume matching up to %d kWh", max)
+		}
+		for range StreamPalindromicFuelCosts(context.Background(), "79", max, 0, WithVolumeUnit(KilowattHours), WithMatch(MatchVolume)) {
+			t.Errorf("volume matching up to %d kWh returned results", max)
+			break
+		}
+	}
+	if err := ValidateSearch("79", 100000, 0, WithVolumeUnit(KilowattHours), WithMatch(MatchVolume)); err != nil {
+		t.Errorf("rejected volume matching up to 100000 kWh: %v", err)
+	}
+}
+
+func TestFindNearestPalindromicCost(t *testing.T) {
+	tests := []struct {
+		name          string
+		pricePerLitre float64
+		targetLitres  float64
+		searchRadius  int
+		expectResult  bool
+	}{
+		{"find near 25", 128.9, 25.0, 10, true},
+		{"find near 30", 128.9, 30.0, 10, true},
+		{"no result in radius", 128.9, 1000.0, 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FindNearestPalindromicCost(tt.pricePerLitre, tt.targetLitres, tt.searchRadius, 0.01)
+			if tt.expectResult && result == nil {
+				t.Errorf("FindNearestPalindromicCost(%f, %f, %d) expected result but got nil",
+					tt.pricePerLitre, tt.targetLitres, tt.searchRadius)
+			} else if !tt.expectResult && result != nil {
+				t.Errorf("FindNearestPalindromicCost(%f, %f, %d) expected nil but got result",
+					tt.pricePerLitre, tt.targetLitres, tt.searchRadius)
+			}
+		})
+	}
+}
+
+func TestFindPalindromicCostForTarget(t *testing.T) {
+	tests := []struct {
+		name              string
+		pricePerLitre     float64
+		targetPounds      float64
+		searchRadiusPence int
+		expectedCount     int
+	}{
+		{"find near £32.23", 128.9, 32.23, 100, 1},
+		{"find near £50.05", 128.9, 50.05, 100, 1},
+		{"no results in radius", 128.9, 1000.00, 10, 0},
+		{"multiple results", 128.9, 50.00, 500, 2}, // Should find both 32.23 and 50.05
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := FindPalindromicCostForTarget(tt.pricePerLitre, tt.targetPounds, tt.searchRadiusPence, 0.01)
+			if len(results) != tt.expectedCount {
+				t.Errorf("FindPalindromicCostForTarget(%f, %f, %d) returned %d results, want %d",
+					tt.pricePerLitre, tt.targetPounds, tt.searchRadiusPence, len(results), tt.expectedCount)
+			}
+		})
+	}
+}
+
+func TestParsePriceRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    PriceRange
+		wantErr bool
+	}{
+		{"120:160:0.1", PriceRange{"120", "160", "0.1"}, false},
+		{"128.9:129", PriceRange{"128.9", "129", "0.1"}, false},
+		{"120", PriceRange{}, true},
+		{"160:120:0.1", PriceRange{}, true},
+		{"120:160:0", PriceRange{}, true},
+		{"1:100000:0.001", PriceRange{}, true},
+		{"a:b", PriceRange{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePriceRange(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePriceRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		} else if !tt.wantErr && got != tt.want {
+			t.Errorf("ParsePriceRange(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	prices := slices.Collect(PriceRange{"128.9", "129.2", "0.1"}.Prices())
+	if want := []Price{"128.9", "129.0", "129.1", "129.2"}; !reflect.DeepEqual(prices, want) {
+		t.Errorf("Prices() = %v, want %v", prices, want)
+	}
+	if n := len(slices.Collect(DefaultPriceRange.Prices())); n != 401 {
+		t.Errorf("DefaultPriceRange holds %d prices, want 401", n)
+	}
+}
+
+func TestFindPricesForCost(t *testing.T) {
+	results := FindPricesForCost(50.05, 125, 130, 0.1, 0)
+	var prices []Price
+	for _, result := range results {
+		prices = append(prices, result.Price)
+		if result.CostPounds != "50.05" {
+			t.Errorf("at %s the fill costs £%s, want £50.05", result.Price, result.CostPounds)
+		}
+	}
+	if want := []Price{"125.0", "125.1", "128.9"}; !reflect.DeepEqual(prices, want) {
+		t.Errorf("FindPricesForCost(50.05) found %v, want %v", prices, want)
+	}
+	// At 125.1p the pump still shows 40.00 litres once the cost reaches £50.05
+	if results[1].Type != "whole" || results[1].Litres != 40 {
+		t.Errorf("at 125.1p want 40 whole litres, got %+v", results[1])
+	}
+	if results[2].Volume != "38.83" {
+		t.Errorf("at 128.9p want 38.83 litres, got %+v", results[2])
+	}
+
+	if results := FindPricesForCost(50.05, 130, 125, 0.1, 0); len(results) != 0 {
+		t.Errorf("backwards range found %v", results)
+	}
+	if results := FindPricesForCost(-1, 125, 130, 0.1, 0); len(results) != 0 {
+		t.Errorf("negative total found %v", results)
+	}
+
+	// A 125p a litre discount rules out the cheaper prices, not the rest
+	discounted := FindPricesForCost(20, 120, 140, 0.1, 0, WithDiscount(Discount{PerUnit: 125}))
+	if len(discounted) == 0 {
+		t.Fatal("expected prices above 125p to work with a 125p discount")
+	}
+	for _, result := range discounted {
+		if result.Price.Float64() <= 125 {
+			t.Errorf("found %sp, which a 125p discount takes to nothing", result.Price)
+		}
+	}
+}
+
+func TestFindTriplePalindromes(t *testing.T) {
+	results := FindTriplePalindromes(context.Background(), DefaultPriceRange, 100, 0)
+	var receipts []string
+	for _, result := range results {
+		receipts = append(receipts, result.Price.String()+" "+result.Volume+" "+result.CostPounds)
+		if !result.IsTriplePalindrome() || !result.PriceIsPalindrome {
+			t.Errorf("%+v isn't a triple palindrome", result)
+		}
+	}
+	want := []string{"133.1 13.31 17.71", "144.1 17.71 25.52", "155.1 64.46 99.99"}
+	if !reflect.DeepEqual(receipts, want) {
+		t.Errorf("FindTriplePalindromes found %v, want %v", receipts, want)
+	}
+
+	// Palindromic prices are flagged on every result
+	for _, result := range FindPalindromicFuelCosts(133.1, 100, 0) {
+		if !result.PriceIsPalindrome {
+			t.Errorf("result at 133.1p not flagged: %+v", result)
+		}
+	}
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0) {
+		if result.PriceIsPalindrome || result.IsTriplePalindrome() {
+			t.Errorf("result at 128.9p flagged: %+v", result)
+		}
+	}
+
+	for price, want := range map[Price]bool{"133.1": true, "128.821": true, "121": true, "121.0": false, "128.9": false} {
+		if got := price.IsPalindrome(); got != want {
+			t.Errorf("Price(%q).IsPalindrome() = %v, want %v", price, got, want)
+		}
+	}
+}
+
+func TestFindSplitPayments(t *testing.T) {
+	tests := []struct {
+		split Split
+		want  map[string][]string
+	}{
+		{Split{Ways: 2, Equal: true}, map[string][]string{"64.46": {"32.23", "32.23"}}},
+		{Split{Ways: 2}, map[string][]string{
+			"32.23": {"12.21", "20.02"},
+			"50.05": {"20.02", "30.03"},
+			"54.45": {"24.42", "30.03"},
+			"64.46": {"32.23", "32.23"},
+		}},
+		{Split{Ways: 3}, map[string][]string{
+			"32.23": {"10.01", "11.11", "11.11"},
+			"50.05": {"10.01", "20.02", "20.02"},
+			"54.45": {"14.41", "20.02", "20.02"},
+			"64.46": {"21.12", "21.12", "22.22"},
+		}},
+	}
+
+	for _, tt := range tests {
+		got := map[string][]string{}
+		for _, result := range FindSplitPayments(context.Background(), "128.9", 100, 0, tt.split) {
+			got[result.CostPounds] = result.Payments
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.split, got, tt.want)
+		}
+	}
+
+	// A free split is the most even one there is
+	palindromes := []int64{}
+	for units := int64(1); units <= 10000; units++ {
+		if isPalindromeString(formatPounds(int(units))) {
+			palindromes = append(palindromes, units)
+		}
+	}
+	for _, total := range []int64{3223, 5005, 6446, 9999} {
+		best := int64(-1)
+		for _, a := range palindromes {
+			if b := total - a; b >= a && slices.Contains(palindromes, b) && (best < 0 || b-a < best) {
+				best = b - a
+			}
+		}
+		payments := splitEvenly(palindromes, total, 2)
+		if best < 0 {
+			if payments != nil {
+				t.Errorf("%d split into %v, want no split", total, payments)
+			}
+			continue
+		}
+		if len(payments) != 2 || payments[0]+payments[1] != total || payments[1]-payments[0] != best {
+			t.Errorf("%d split into %v, want a spread of %d", total, payments, best)
+		}
+	}
+
+	if results := FindSplitPayments(context.Background(), "128.9", 100, 0, Split{Ways: 5}); results != nil {
+		t.Errorf("a 5-way split found %v, want nothing", results)
+	}
+}
+
+func TestNextTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		current float64
+		n       int
+		opts    []Option
+		want    []string
+	}{
+		{"mid-fill", 31.40, 5, nil, []string{"50.05", "54.45", "64.46"}},
+		{"just the next", 31.40, 1, nil, []string{"50.05"}},
+		{"on a target", 38.83, 5, nil, []string{"54.45", "64.46"}},
+		{"from empty", 0, 2, nil, []string{"32.23", "50.05"}},
+		{"tank nearly full", 31.40, 5, []Option{WithTank(Tank{Capacity: 55, Level: 15})}, []string{"50.05"}},
+		{"past the last", 60, 5, []Option{WithTank(Tank{Capacity: 55})}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, target := range NextTargets("128.9", tt.current, tt.n, 0, tt.opts...) {
+				got = append(got, target.CostPounds)
+				toGo := target.Litres - tt.current
+				if math.Abs(target.LitresToGo-toGo) > 1e-9 {
+					t.Errorf("%s: LitresToGo = %v, want %v", target.CostPounds, target.LitresToGo, toGo)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NextTargets found %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// How much more the pump has to show, from 31.40 L showing £40.47
+	targets := NextTargets("128.9", 31.40, 1, 0)
+	if len(targets) != 1 || targets[0].CostToGo != "9.58" {
+		t.Errorf("expected £9.58 to go to £50.05, got %+v", targets)
+	}
+
+	// A reading of the cost finds the same targets
+	current := litresForCost("128.9", 40.47, GBP)
+	if fromCost := NextTargets("128.9", current, 1, 0); len(fromCost) != 1 || fromCost[0].CostPounds != "50.05" {
+		t.Errorf("from £40.47, expected £50.05 next, got %+v", fromCost)
+	}
+
+	// Volume targets can be ahead while the total stays the same
+	for _, target := range NextTargets("79", 12.30, 3, 0, WithVolumeUnit(KilowattHours), WithMatch(MatchVolume)) {
+		if target.Litres <= 12.30 || !isPalindromeString(target.Volume) {
+			t.Errorf("volume target %+v isn't a palindromic reading ahead of 12.30 kWh", target.Result)
+		}
+	}
+
+	if targets := NextTargets("128.9", -1, 5, 0); targets != nil {
+		t.Errorf("a negative reading found %v, want nothing", targets)
+	}
+}
+
+func TestSweepPrices(t *testing.T) {
+	sweep, err := SweepPrices(context.Background(), PriceRange{"128.5", "129", "0.1"}, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sweep.Prices) != 6 {
+		t.Fatalf("sweep covered %d prices, want 6", len(sweep.Prices))
+	}
+
+	total, most := 0, 0
+	for _, stats := range sweep.Prices {
+		results := FindPalindromicFuelCostsAt(stats.Price, 100, 0)
+		if stats.Total != len(results) || stats.Whole+stats.Decimal != stats.Total || stats.Double > stats.Total {
+			t.Errorf("at %s: %+v, but the search found %d results", stats.Price, stats, len(results))
+		}
+		if stats.Total > 0 && !slices.ContainsFunc(results, func(r Result) bool { return reflect.DeepEqual(r, *stats.Best) }) {
+			t.Errorf("at %s the best result %+v isn't one of the results", stats.Price, *stats.Best)
+		}
+		total += stats.Total
+		most = max(most, stats.Total)
+	}
+	if sweep.Total != total || sweep.Mean != float64(total)/6 {
+		t.Errorf("sweep total %d, mean %v; want %d", sweep.Total, sweep.Mean, total)
+	}
+	if i := slices.IndexFunc(sweep.Prices, func(s PriceStats) bool { return s.Price == sweep.Luckiest }); i < 0 || sweep.Prices[i].Total != most {
+		t.Errorf("luckiest price %s doesn't have the most results (%d)", sweep.Luckiest, most)
+	}
+
+	// Nothing palindromic costs under £1.01, so a single litre finds nothing
+	sweep, err = SweepPrices(context.Background(), PriceRange{"50", "52", "1"}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Price{"50", "51", "52"}; !reflect.DeepEqual(sweep.Dead, want) || sweep.Luckiest != "" {
+		t.Errorf("dead prices = %v, luckiest %q; want %v", sweep.Dead, sweep.Luckiest, want)
+	}
+
+	if _, err := SweepPrices(context.Background(), PriceRange{"130", "120", "1"}, 100, 0); err == nil {
+		t.Error("expected an error for a backwards range")
+	}
+	if _, err := SweepPrices(context.Background(), DefaultPriceRange, 0, 0); err == nil {
+		t.Error("expected an error for no volume")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := SweepPrices(ctx, DefaultPriceRange, 100, 0); err == nil {
+		t.Error("expected a cancelled sweep to fail")
+	}
+}
+
+func TestWriteSweep(t *testing.T) {
+	best := Result{Litres: 38.83, CostPounds: "50.05", LitresIsPalindrome: true, Type: "palindromic_decimal", WindowMl: 7.8, Volume: "38.83"}
+	sweep := Sweep{
+		Prices: []PriceStats{
+			{Price: "128.9", Whole: 2, Decimal: 2, Double: 2, Total: 4, Best: &best},
+			{Price: "129"},
+		},
+		Luckiest: "128.9",
+		Dead:     []Price{"129"},
+		Total:    4,
+		Mean:     2,
+	}
+
+	var buf bytes.Buffer
+	if err := writeSweepCSV(&buf, sweep, GBP, Litres); err != nil {
+		t.Fatal(err)
+	}
+	want := "Price per Litre (p),Whole,Decimal,Double,Total,Best Litres,Best Cost (£),Best Stop Window (ml)\n" +
+		"128.9,2,2,2,4,38.83,50.05,7.8\n" +
+		"129,0,0,0,0,,,\n"
+	if buf.String() != want {
+		t.Errorf("writeSweepCSV wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeSweepTable(&buf, sweep, GBP, Litres); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"38.83 L = £50.05 [7.8 ml]", "Luckiest price: 128.9p/litre with 4 results", "Dead prices: 1 (129p)"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("table is missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestStopWindow(t *testing.T) {
+	// A metered pump shows each penny for 1p / 128.9p of a litre
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0) {
+		if math.Abs(result.WindowMl-1000/128.9) > 1e-9 {
+			t.Errorf("%s window = %f ml, want %f ml", result.CostPounds, result.WindowMl, 1000/128.9)
+		}
+	}
+
+	// Pricing the displayed litres gives whole 10 ml steps, or none at all
+	displayed := DefaultPumpModel
+	displayed.CostBasis = CostFromDisplayed
+	results := FindPalindromicFuelCosts(128.9, 100, 0, WithPumpModel(displayed))
+	if len(results) == 0 {
+		t.Fatalf("expected results from a displayed-basis pump")
+	}
+	for _, result := range results {
+		if steps := result.WindowMl / 10; math.Abs(steps-math.Round(steps)) > 1e-6 || steps < 1 {
+			t.Errorf("%s window = %f ml, want a multiple of 10 ml", result.CostPounds, result.WindowMl)
+		}
+	}
+
+	if filtered := FindPalindromicFuelCosts(128.9, 100, 0, WithMinWindow(8)); len(filtered) != 0 {
+		t.Errorf("WithMinWindow(8) kept %d results narrower than 8 ml", len(filtered))
+	}
+}
+
+func TestScoreModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   float64
+	}{
+		{"double palindrome", Result{Litres: 38.83, LitresIsPalindrome: true, Pattern: "palindrome", Price: "128.9", WindowMl: 7.5}, 40 + 20 + 7.5 + 10},
+		{"palindromic litres, round cost", Result{Litres: 12.21, LitresIsPalindrome: true, Pattern: "round", Price: "128.9"}, 20 + 10},
+		{"whole litres", Result{Litres: 25, Pattern: "palindrome", Price: "128.9", WindowMl: 7.5}, 10 + 7.5},
+		{"multiple of ten", Result{Litres: 50, Pattern: "palindrome", Price: "128.9"}, 20},
+		{"palindromic price", Result{Litres: 25, Pattern: "palindrome", Price: "128.821"}, 15 + 10},
+		{"wide window capped", Result{Litres: 12.34, Pattern: "palindrome", Price: "128.9", WindowMl: 50}, 20},
+		{"half symmetric", Result{Litres: 12.31, Pattern: "palindrome", Price: "128.9"}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultScoreModel.Score(tt.result); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score(%+v) = %v, want %v", tt.result, got, tt.want)
+			}
+		})
+	}
+
+	if got := (ScoreModel{}).Score(tests[0].result); got != 0 {
+		t.Errorf("empty model scored %v", got)
+	}
+}
+
+func TestFindWithScore(t *testing.T) {
+	results := FindPalindromicFuelCosts(128.9, 100, 0)
+	for _, result := range results {
+		if result.Score != DefaultScoreModel.Score(result) {
+			t.Errorf("%s litres scored %v, want %v", result.Volume, result.Score, DefaultScoreModel.Score(result))
+		}
+	}
+
+	// Only the double palindromes score 60 or more
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0, WithMinScore(60)) {
+		if !result.LitresIsPalindrome {
+			t.Errorf("min score kept %+v", result)
+		}
+	}
+
+	model := ScoreModel{RoundLitres: 1}
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0, WithScoreModel(model)) {
+		if want := model.Score(result); result.Score != want {
+			t.Errorf("custom model scored %s litres %v, want %v", result.Volume, result.Score, want)
+		}
+	}
+}
+
+func TestParseTankLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		capacity float64
+		want     float64
+		wantErr  bool
+	}{
+		{"", 55, 0, false},
+		{"20", 55, 20, false},
+		{"20", 0, 20, false},
+		{"1/4", 60, 15, false},
+		{"3 / 4", 60, 45, false},
+		{"25%", 60, 15, false},
+		{"1/4", 0, 0, true},
+		{"1/0", 60, 0, true},
+		{"full", 60, 0, true},
+		{"x%", 60, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTankLevel(tt.input, tt.capacity)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTankLevel(%q, %v) error = %v, wantErr %v", tt.input, tt.capacity, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTankLevel(%q, %v) = %v, want %v", tt.input, tt.capacity, got, tt.want)
+		}
+	}
+}
+
+func TestTankValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tank    Tank
+		wantErr bool
+	}{
+		{"none", Tank{}, false},
+		{"quarter full", Tank{Capacity: 60, Level: 15, MinFill: 20}, false},
+		{"no capacity", Tank{Level: 15, MinFill: 20}, false},
+		{"negative capacity", Tank{Capacity: -1}, true},
+		{"negative level", Tank{Capacity: 60, Level: -1}, true},
+		{"overfull", Tank{Capacity: 60, Level: 61}, true},
+		{"min fill won't fit", Tank{Capacity: 60, Level: 50, MinFill: 20}, true},
+		{"NaN level", Tank{Capacity: 60, Level: math.NaN()}, true},
+		{"infinite capacity", Tank{Capacity: math.Inf(1)}, true},
+		{"infinite min fill", Tank{MinFill: math.Inf(1)}, true},
+		{"NaN capacity", Tank{Capacity: math.NaN(), Level: 15}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tank.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := newSearch("128.9", 0, []Option{WithTank(Tank{Capacity: -1})}); err == nil {
+		t.Error("newSearch accepted a bad tank")
+	}
+}
+
+func TestFindWithTank(t *testing.T) {
+	tank := Tank{Capacity: 55, Level: 13.75, MinFill: 20}
+	results := FindPalindromicFuelCosts(128.9, 100, 0, WithTank(tank))
+	if len(results) == 0 {
+		t.Fatal("expected fills that fit the tank")
+	}
+	for _, result := range results {
+		if result.Litres < tank.MinFill || result.Litres > tank.Space() {
+			t.Errorf("%v litres doesn't fit a tank with %v litres of space and a %v litre minimum", result.Litres, tank.Space(), tank.MinFill)
+		}
+		if math.Abs(result.TankLevel-(tank.Level+result.Litres)) > 1e-9 {
+			t.Errorf("%v litres left the tank at %v", result.Litres, result.TankLevel)
+		}
+		if math.Abs(result.TankFull-result.TankLevel/tank.Capacity) > 1e-9 {
+			t.Errorf("%v litres left the tank %v full", result.Litres, result.TankFull)
+		}
+	}
+
+	// Without a capacity only the minimum fill applies
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0, WithTank(Tank{MinFill: 40})) {
+		if result.Litres < 40 || result.TankFull != 0 {
+			t.Errorf("min fill kept %+v", result)
+		}
+	}
+
+	for _, result := range FindPalindromicFuelCosts(128.9, 100, 0) {
+		if result.TankLevel != 0 || result.TankFull != 0 {
+			t.Errorf("no tank, but %+v has a tank level", result)
+		}
+	}
+}
+
+func TestTankUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Tank
+		wantErr bool
+	}{
+		{`{"capacity": 60, "level": 15}`, Tank{Capacity: 60, Level: 15}, false},
+		{`{"capacity": 60, "level": "1/4", "minFill": 20}`, Tank{Capacity: 60, Level: 15, MinFill: 20}, false},
+		{`{"capacity": 60, "level": "50%"}`, Tank{Capacity: 60, Level: 30}, false},
+		{`{"capacity": 60}`, Tank{Capacity: 60}, false},
+		{`{"level": "1/4"}`, Tank{}, true},
+		{`{"capacity": 60, "level": true}`, Tank{}, true},
+	}
+
+	for _, tt := range tests {
+		var got Tank
+		err := json.Unmarshal([]byte(tt.input), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// useTempGarage points the default garage at a temporary config directory
+// and returns its path
+func useTempGarage(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AppData", dir)
+	path, err := DefaultGaragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGarage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "palindromic-fuel", "vehicles.json")
+
+	garage, err := LoadGarage(path)
+	if err != nil || len(garage.Vehicles) != 0 {
+		t.Fatalf("LoadGarage(missing) = %+v, %v; want an empty garage", garage, err)
+	}
+
+	pump := PumpModel{VolumeDecimals: 3, VolumeRounding: RoundHalfUp, CostRounding: RoundHalfUp, CostBasis: CostFromDisplayed}
+	van := Vehicle{Name: "Van", Capacity: 80, FuelType: "diesel", TypicalFill: 60, Pump: &pump}
+	if replaced, err := garage.Add(van); err != nil || replaced {
+		t.Fatalf("Add(van) = %v, %v", replaced, err)
+	}
+	if _, err := garage.Add(Vehicle{Name: " Hatch ", Capacity: 45}); err != nil {
+		t.Fatal(err)
+	}
+	if replaced, err := garage.Add(Vehicle{Name: "van", Capacity: 75}); err != nil || !replaced {
+		t.Errorf("Add(van again) = %v, %v; want it replaced", replaced, err)
+	}
+	if err := garage.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadGarage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Vehicles) != 2 {
+		t.Fatalf("loaded %d vehicles, want 2", len(loaded.Vehicles))
+	}
+	if v, err := loaded.Vehicle("HATCH"); err != nil || v.Name != "Hatch" || v.Capacity != 45 {
+		t.Errorf("Vehicle(HATCH) = %+v, %v", v, err)
+	}
+	if v, _ := loaded.Vehicle("van"); v.Capacity != 75 || v.Pump != nil {
+		t.Errorf("replaced van = %+v", v)
+	}
+
+	if err := loaded.Remove("Van"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.Vehicle("van"); err == nil {
+		t.Error("removed van is still there")
+	}
+	if err := loaded.Remove("van"); err == nil {
+		t.Error("removing a missing vehicle succeeded")
+	}
+
+	os.WriteFile(path, []byte("not json"), 0o644)
+	if _, err := LoadGarage(path); err == nil {
+		t.Error("LoadGarage(bad JSON) succeeded")
+	}
+}
+
+func TestVehicleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		vehicle Vehicle
+		wantErr bool
+	}{
+		{"hatch", Vehicle{Name: "hatch", Capacity: 45}, false},
+		{"gallons", Vehicle{Name: "pickup", Capacity: 26, Unit: "us-gallons", TypicalFill: 20}, false},
+		{"no name", Vehicle{Name: " ", Capacity: 45}, true},
+		{"no capacity", Vehicle{Name: "hatch"}, true},
+		{"typical fill too big", Vehicle{Name: "hatch", Capacity: 45, TypicalFill: 50}, true},
+		{"bad unit", Vehicle{Name: "hatch", Capacity: 45, Unit: "pints"}, true},
+		{"bad pump", Vehicle{Name: "hatch", Capacity: 45, Pump: &PumpModel{VolumeDecimals: 9}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.vehicle.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := (Vehicle{Capacity: 44.5}).MaxVolume(); got != 45 {
+		t.Errorf("MaxVolume() = %d, want 45", got)
+	}
+	if got := (Vehicle{Capacity: 80, TypicalFill: 60}).MaxVolume(); got != 60 {
+		t.Errorf("MaxVolume() = %d, want the typical fill, 60", got)
+	}
+}
+
+func TestRunVehicleCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.json")
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		err := runVehicleCommand(args, path, &out)
+		return out.String(), err
+	}
+
+	if out, err := run("list"); err != nil || !strings.Contains(out, "No saved vehicles") {
+		t.Errorf("list (empty) = %q, %v", out, err)
+	}
+	if out, err := run("add", "van", "-capacity=80", "-fuel=Diesel", "-typical-fill=60", "-cost-basis=displayed"); err != nil || out != "Saved van (diesel, 80 L, usually 60)\n" {
+		t.Errorf("add = %q, %v", out, err)
+	}
+	if out, err := run("add", "pickup", "-capacity=26", "-unit=us-gallons"); err != nil || out != "Saved pickup (26 gal)\n" {
+		t.Errorf("add = %q, %v", out, err)
+	}
+	if out, err := run("list"); err != nil || strings.Count(out, "\n") != 2 {
+		t.Errorf("list = %q, %v", out, err)
+	}
+
+	garage, _ := LoadGarage(path)
+	van, _ := garage.Vehicle("van")
+	if van.Pump == nil || van.Pump.CostBasis != CostFromDisplayed {
+		t.Errorf("van's pump = %+v, want it to price displayed volume", van.Pump)
+	}
+	if pickup, _ := garage.Vehicle("pickup"); pickup.Pump != nil || pickup.Unit != "us-gallons" {
+		t.Errorf("pickup = %+v, want gallons and no pump", pickup)
+	}
+
+	if out, err := run("remove", "VAN"); err != nil || out != "Removed VAN\n" {
+		t.Errorf("remove = %q, %v", out, err)
+	}
+
+	for _, args := range [][]string{
+		nil,
+		{"fly"},
+		{"add"},
+		{"add", "-capacity=45"},
+		{"add", "hatch"},
+		{"add", "hatch", "-capacity=45", "extra"},
+		{"add", "hatch", "-capacity=45", "-cost-rounding=sideways"},
+		{"remove"},
+		{"remove", "van"},
+	} {
+		if _, err := run(args...); err == nil {
+			t.Errorf("vehicle %q succeeded", args)
+		}
+	}
+}
+
+func TestApplyVehicle(t *testing.T) {
+	newFlags := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("unit", Litres.Code, "")
+		fs.Int("max", 10000, "")
+		fs.Float64("tank", 0, "")
+		fs.Int("volume-dp", DefaultPumpModel.VolumeDecimals, "")
+		fs.String("volume-rounding", string(DefaultPumpModel.VolumeRounding), "")
+		fs.String("cost-rounding", string(DefaultPumpModel.CostRounding), "")
+		fs.String("cost-basis", string(DefaultPumpModel.CostBasis), "")
+		return fs
+	}
+	pump := PumpModel{VolumeDecimals: 3, VolumeRounding: RoundDown, CostRounding: RoundHalfUp, CostBasis: CostFromDisplayed}
+	van := Vehicle{Name: "van", Capacity: 80, TypicalFill: 60, Pump: &pump}
+
+	fs := newFlags()
+	fs.Parse([]string{"-max=100", "-cost-rounding=up"})
+	if err := applyVehicle(fs, van); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"unit":            "litres",
+		"max":             "100",
+		"tank":            "80",
+		"volume-dp":       "3",
+		"volume-rounding": "down",
+		"cost-rounding":   "up",
+		"cost-basis":      "displayed",
+	}
+	for name, value := range want {
+		if got := fs.Lookup(name).Value.String(); got != value {
+			t.Errorf("-%s = %q, want %q", name, got, value)
+		}
+	}
+
+	fs = newFlags()
+	fs.Parse([]string{"-unit=us-gallons"})
+	if err := applyVehicle(fs, van); err == nil {
+		t.Error("applied a litres vehicle to a gallons search")
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := []Result{
+		{Litres: 25, WindowMl: 5},
+		{Litres: 38.83, WindowMl: 10},
+		{Litres: 12, WindowMl: 10},
+	}
+
+	SortResults(results, SortByWindow)
+	if results[0].Litres != 38.83 || results[1].Litres != 12 || results[2].Litres != 25 {
+		t.Errorf("SortResults(window) = %+v, want widest first keeping ties in order", results)
+	}
+
+	SortResults(results, SortByLitres)
+	if results[0].Litres != 12 || results[1].Litres != 25 || results[2].Litres != 38.83 {
+		t.Errorf("SortResults(litres) = %+v, want increasing litres", results)
+	}
+
+	results[1].Score = 60
+	SortResults(results, SortByScore)
+	if results[0].Litres != 25 || results[1].Litres != 12 || results[2].Litres != 38.83 {
+		t.Errorf("SortResults(score) = %+v, want highest score first keeping ties in order", results)
+	}
+
+	if _, err := ParseSortOrder("price"); err == nil {
+		t.Errorf("ParseSortOrder(\"price\") expected error")
+	}
+}
+
+func TestBatchFindPalindromicCosts(t *testing.T) {
+	tests := []struct {
+		name         string
+		prices       []float64
+		maxLitres    int
+		expectedKeys int
+	}{
+		{"single price", []float64{128.9}, 100, 1},
+		{"multiple prices", []float64{128.9, 135.7}, 50, 2},
+		{"empty prices", []float64{}, 100, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := BatchFindPalindromicCosts(tt.prices, tt.maxLitres, 0.01)
+			if len(results) != tt.expectedKeys {
+				t.Errorf("BatchFindPalindromicCosts(%v, %d) returned %d results, want %d keys",
+					tt.prices, tt.maxLitres, len(results), tt.expectedKeys)
+			}
+
+			// Verify each price has results
+			for _, price := range tt.prices {
+				if _, exists := results[price]; !exists {
+					t.Errorf("BatchFindPalindromicCosts missing results for price %f", price)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+	}{
+		{"whole number litres", Result{
+			Litres:             25.0,
+			CostPounds:         "32.23",
+			LitresIsPalindrome: false,
+			Type:               "whole",
+		}},
+		{"palindromic whole litres", Result{
+			Litres:             121.0,
+			CostPounds:         "50.05",
+			LitresIsPalindrome: true,
+			Type:               "whole",
+		}},
+		{"palindromic decimal litres", Result{
+			Litres:             38.83,
+			CostPounds:         "50.05",
+			LitresIsPalindrome: true,
+			Type:               "palindromic_decimal",
+		}},
+		{"decimal litres", Result{
+			Litres:             15.75,
+			CostPounds:         "20.31",
+			LitresIsPalindrome: false,
+			Type:               "whole",
+		}},
+		{"discounted", Result{
+			Litres:         32.23,
+			CostPounds:     "39.93",
+			Type:           "palindromic_decimal",
+			PumpPounds:     "41.54",
+			DiscountPounds: "1.61",
+		}},
+		{"with VAT", Result{
+			Litres:             1.41,
+			CostPounds:         "1.81",
+			LitresIsPalindrome: true,
+			Type:               "palindromic_decimal",
+			NetPounds:          "1.51",
+			VATPounds:          "0.30",
+			NetMatches:         true,
+			VATMatches:         true,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Test that it doesn't panic
+			printResult(tt.result)
+		})
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	results := []Result{
+		{Litres: 25.0, CostPounds: "32.23", LitresIsPalindrome: false, Type: "whole"},
+		{Litres: 38.83, CostPounds: "50.05", LitresIsPalindrome: true, Type: "palindromic_decimal"},
+	}
+
+	// Test that it doesn't panic
+	printResults(slices.Values(results), "128.9", GBP, Litres, PalindromePattern{})
+}
+
+func TestExportToCSV(t *testing.T) {
 	results := []Result{
 		{Litres: 25.0, CostPounds: "32.23", LitresIsPalindrome: false, Type: "whole"},
 		{Litres: 38.83, CostPounds: "50.05", LitresIsPalindrome: true, Type: "palindromic_decimal"},
 	}
 
-	// Test that it doesn't panic
-	printResults(results, 128.9)
+	// Test export to temporary file
+	tmpfile, err := os.CreateTemp("", "test_export_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	err = exportToCSV(tmpfile.Name(), slices.Values(results), "128.9", GBP, Litres)
+	if err != nil {
+		t.Errorf("exportToCSV failed: %v", err)
+	}
+
+	// Read back the file and verify content
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Errorf("Failed to read exported file: %v", err)
+	}
+
+	contentStr := string(content)
+	// Check for expected content
+	expectedLines := []string{
+		"Price per Litre (p),Litres,Cost (£),Litres is Palindrome,Type",
+		"128.9,25,32.23,No,whole",
+		"128.9,38.83,50.05,Yes,palindromic_decimal",
+		"Stop Window (ml),Score,Price is Palindrome,Triple Palindrome",
+	}
+
+	for _, line := range expectedLines {
+		if !strings.Contains(contentStr, line) {
+			t.Errorf("Expected line %q not found in exported CSV", line)
+		}
+	}
+}
+
+func TestExportToCSVGallons(t *testing.T) {
+	results := []Result{
+		{Litres: 4.004, Volume: "4.004", CostPounds: "14.41", LitresIsPalindrome: true, Type: "palindromic_decimal", Currency: "USD", Unit: "us-gallons"},
+	}
+
+	tmpfile, err := os.CreateTemp("", "test_export_gallons_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	if err := exportToCSV(tmpfile.Name(), slices.Values(results), "359.9", USD, USGallons); err != nil {
+		t.Fatalf("exportToCSV failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %v", err)
+	}
+
+	for _, line := range []string{
+		"Price per Gallon (¢),Gallons,Cost ($),Gallons is Palindrome,Type",
+		"359.9,4.004,14.41,Yes,palindromic_decimal",
+	} {
+		if !strings.Contains(string(content), line) {
+			t.Errorf("Expected line %q not found in exported CSV:\n%s", line, content)
+		}
+	}
+
+	// With nothing found, the header is still in the search's currency and unit
+	if err := exportToCSV(tmpfile.Name(), slices.Values([]Result(nil)), "359.9", USD, USGallons); err != nil {
+		t.Fatalf("exportToCSV failed: %v", err)
+	}
+	if content, _ := os.ReadFile(tmpfile.Name()); !strings.HasPrefix(string(content), "Price per Gallon (¢),Gallons,Cost ($)") {
+		t.Errorf("empty export header = %q, want gallons and dollars", content)
+	}
+}
+
+func TestHandleAPI(t *testing.T) {
+	// Test GET request
+	req, err := http.NewRequest("GET", "/api/calculate?price=128.9&max=50", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(handleAPI)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Errorf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Results) == 0 {
+		t.Errorf("Expected some results, got 0")
+	}
+
+	if response.Error != "" {
+		t.Errorf("Unexpected error in response: %s", response.Error)
+	}
+}
+
+func TestHandleAPI_POST(t *testing.T) {
+	// Test POST request
+	reqBody := CalculateRequest{PricePerLitre: 128.9, MaxLitres: 50}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	req, err := http.NewRequest("POST", "/api/calculate", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(handleAPI)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Errorf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Results) == 0 {
+		t.Errorf("Expected some results, got 0")
+	}
+}
+
+func TestHandleAPI_InvalidInput(t *testing.T) {
+	// Test invalid GET request
+	req, err := http.NewRequest("GET", "/api/calculate?price=invalid&max=50", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(handleAPI)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Errorf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Error == "" {
+		t.Errorf("Expected error in response for invalid input")
+	}
+}
+
+func TestHandleAPI_ImpossibleRange(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/calculate?price=128.9&max=0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if !strings.Contains(response.Error, "at least 1 litre") {
+		t.Errorf("expected a range error, got %q", response.Error)
+	}
+}
+
+func TestHandleAPI_Tolerance(t *testing.T) {
+	// £32.23 at 128.8p is 25.023 litres: whole only with a pump tolerance
+	tests := []struct {
+		name     string
+		query    string
+		expected bool
+	}{
+		{"default tolerance", "price=128.8&max=30", false},
+		{"with tolerance", "price=128.8&max=30&tolerance=0.03", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/calculate?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handleAPI(rr, req)
+
+			var response CalculateResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			found := false
+			for _, result := range response.Results {
+				if result.CostPounds == "32.23" {
+					found = true
+				}
+			}
+			if found != tt.expected {
+				t.Errorf("%s: £32.23 found = %v, want %v", tt.query, found, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHandleAPI_PalindromeMode(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=123.21&max=200&palindrome=digits", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Errorf("Expected digits mode results, got 0")
+	}
+
+	req = httptest.NewRequest("GET", "/api/calculate?price=123.21&max=200&palindrome=mirror", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error == "" {
+		t.Errorf("Expected error for unknown palindrome mode")
+	}
+}
+
+func TestHandleAPI_PumpModel(t *testing.T) {
+	// A partial pump model keeps the defaults for the missing fields
+	body := `{"pricePerLitre": 128.9, "maxLitres": 100, "pump": {"costBasis": "displayed", "costRounding": "down"}}`
+	req := httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "" || len(response.Results) != 1 || response.Results[0].CostPounds != "50.05" {
+		t.Errorf("Expected only £50.05 from a truncating displayed-basis pump, got %+v", response)
+	}
+
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&costRounding=sideways", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error == "" {
+		t.Errorf("Expected error for unknown cost rounding")
+	}
+}
+
+func TestHandleAPI_SortAndFilter(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&costBasis=displayed&sort=window&minWindow=10", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "" || len(response.Results) == 0 {
+		t.Fatalf("Expected results, got %+v", response)
+	}
+	for i, result := range response.Results {
+		if result.WindowMl < 10 {
+			t.Errorf("result %s has window %f ml, below the 10 ml minimum", result.CostPounds, result.WindowMl)
+		}
+		if i > 0 && result.WindowMl > response.Results[i-1].WindowMl {
+			t.Errorf("results not sorted by window: %f after %f", result.WindowMl, response.Results[i-1].WindowMl)
+		}
+	}
+}
+
+func TestHandleAPI_Pattern(t *testing.T) {
+	reqBody := CalculateRequest{PricePerLitre: 128.9, MaxLitres: 200, Pattern: "round"}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	req := httptest.NewRequest("POST", "/api/calculate", bytes.NewBuffer(jsonBody))
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatalf("Expected round results, got %+v", response)
+	}
+	for _, result := range response.Results {
+		if !strings.HasSuffix(result.CostPounds, ".00") {
+			t.Errorf("round pattern returned £%s", result.CostPounds)
+		}
+	}
+}
+
+func TestHandleAPI_Base(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=50&base=16", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatalf("Expected hex palindromes, got %+v", response)
+	}
+	for _, result := range response.Results {
+		if result.Base != 16 || !isPalindromeString(result.Representation) {
+			t.Errorf("hex result %s has representation %q", result.CostPounds, result.Representation)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=50&base=16&pattern=repdigit", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Error == "" {
+		t.Errorf("expected an error for repdigits in base 16, got %+v", response)
+	}
+}
+
+func TestHandleFindPrices(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/find-prices?cost=50.05&minPrice=128&maxPrice=129", nil)
+	rr := httptest.NewRecorder()
+	handleFindPrices(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Price != "128.9" {
+		t.Errorf("expected one result at 128.9p, got %+v", response)
+	}
+
+	body := `{"cost": 50.05, "minPrice": 125, "maxPrice": 130, "step": 0.1}`
+	req = httptest.NewRequest("POST", "/api/find-prices", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleFindPrices(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) != 3 {
+		t.Errorf("expected 3 prices, got %+v", response)
+	}
+
+	for _, query := range []string{"", "cost=abc", "cost=50.05&minPrice=160&maxPrice=120", "cost=50.05&pattern=nope"} {
+		req = httptest.NewRequest("GET", "/api/find-prices?"+query, nil)
+		rr = httptest.NewRecorder()
+		handleFindPrices(rr, req)
+		response = CalculateResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Error == "" {
+			t.Errorf("query %q: expected an error, got %s", query, rr.Body.String())
+		}
+	}
+
+	// With several bad prices, the first one is always the one reported
+	for range 10 {
+		req = httptest.NewRequest("GET", "/api/find-prices?cost=50.05&minPrice=a&maxPrice=b&step=c", nil)
+		rr = httptest.NewRecorder()
+		handleFindPrices(rr, req)
+		response = CalculateResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Error != "Invalid minPrice parameter" {
+			t.Fatalf("expected the minPrice error, got %s", rr.Body.String())
+		}
+	}
+}
+
+func TestHandleSplit(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/split?price=128.9&max=100&ways=2&equal=true", nil)
+	rr := httptest.NewRecorder()
+	handleSplit(rr, req)
+
+	var response SplitResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].CostPounds != "64.46" || !reflect.DeepEqual(response.Results[0].Payments, []string{"32.23", "32.23"}) {
+		t.Errorf("expected £64.46 split into 2 × £32.23, got %+v", response)
+	}
+
+	body := `{"pricePerLitre": 128.9, "maxLitres": 100, "ways": 2}`
+	req = httptest.NewRequest("POST", "/api/split", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleSplit(rr, req)
+	response = SplitResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) != 4 {
+		t.Errorf("expected 4 splittable totals, got %+v", response)
+	}
+
+	for _, query := range []string{"", "price=128.9&max=100", "price=128.9&max=100&ways=1", "price=128.9&max=100&ways=2&equal=maybe", "price=abc&max=100&ways=2"} {
+		req = httptest.NewRequest("GET", "/api/split?"+query, nil)
+		rr = httptest.NewRecorder()
+		handleSplit(rr, req)
+		response = SplitResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Error == "" {
+			t.Errorf("query %q: expected an error, got %s", query, rr.Body.String())
+		}
+	}
+}
+
+func TestHandleNextTargets(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/next-targets?price=128.9&cost=40.47&count=2", nil)
+	rr := httptest.NewRecorder()
+	handleNextTargets(rr, req)
+
+	var response NextTargetsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) != 2 || response.Results[0].CostPounds != "50.05" || response.Results[0].CostToGo != "9.58" {
+		t.Errorf("expected £50.05 then £54.45 from £40.47, got %+v", response)
+	}
+
+	body := `{"pricePerLitre": 128.9, "litres": 31.40}`
+	req = httptest.NewRequest("POST", "/api/next-targets", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleNextTargets(rr, req)
+	response = NextTargetsResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) != 3 {
+		t.Errorf("expected 3 targets after 31.40 litres, got %+v", response)
+	}
+
+	for _, query := range []string{"", "price=128.9", "price=128.9&litres=lots", "price=128.9&litres=31.4&count=-1", "price=128.9&litres=31.4&pattern=nope"} {
+		req = httptest.NewRequest("GET", "/api/next-targets?"+query, nil)
+		rr = httptest.NewRecorder()
+		handleNextTargets(rr, req)
+		response = NextTargetsResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Error == "" {
+			t.Errorf("query %q: expected an error, got %s", query, rr.Body.String())
+		}
+	}
+
+	// With both readings bad, litres is always the one reported
+	for range 10 {
+		req = httptest.NewRequest("GET", "/api/next-targets?price=128.9&litres=a&cost=b", nil)
+		rr = httptest.NewRecorder()
+		handleNextTargets(rr, req)
+		response = NextTargetsResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Error != "Invalid litres parameter" {
+			t.Fatalf("expected the litres error, got %s", rr.Body.String())
+		}
+	}
+}
+
+func TestHandleWebUI_FindPrices(t *testing.T) {
+	form := strings.NewReader("cost=50.05&minPrice=128&maxPrice=129")
+	req := httptest.NewRequest("POST", "/?tab=prices", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handleWebUI(rr, req)
+
+	if body := rr.Body.String(); !strings.Contains(body, "128.9p/litre: 38.83 L = £50.05") {
+		t.Errorf("price finder page is missing the 128.9p result")
+	}
+
+	// 41 litres at 122p is £50.02, so only a tolerance finds it
+	form = strings.NewReader("cost=50.05&minPrice=122&maxPrice=122.2&tolerance=0.05")
+	req = httptest.NewRequest("POST", "/?tab=prices", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handleWebUI(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "122.0p/litre: 41") {
+		t.Errorf("price finder ignored the tolerance")
+	}
+	if !strings.Contains(body, `value="0.05"`) {
+		t.Errorf("price finder form lost the tolerance")
+	}
+}
+
+func TestHandleAPI_Score(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&sort=score&minScore=20", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatalf("Expected results, got %+v", response)
+	}
+	for i, result := range response.Results {
+		if result.Score < 20 {
+			t.Errorf("minScore=20 kept a result scoring %v", result.Score)
+		}
+		if i > 0 && result.Score > response.Results[i-1].Score {
+			t.Errorf("results not in score order: %v after %v", result.Score, response.Results[i-1].Score)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&minScore=lots", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	if !strings.Contains(rr.Body.String(), "Invalid minScore parameter") {
+		t.Errorf("expected a minScore error, got %s", rr.Body.String())
+	}
+}
+
+func TestHandleAPI_Tank(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&tank=55&level=25%25&minFill=20", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatalf("Expected results, got %+v", response)
+	}
+	for _, result := range response.Results {
+		if result.Litres < 20 || result.TankLevel > 55 {
+			t.Errorf("%v litres doesn't fit, leaving %v in the tank", result.Litres, result.TankLevel)
+		}
+	}
+
+	body := `{"pricePerLitre": 128.9, "maxLitres": 100, "tank": {"capacity": 55, "level": "3/4"}}`
+	req = httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	for _, result := range response.Results {
+		if result.Litres > 13.75 {
+			t.Errorf("%v litres won't fit in a three-quarters full 55 litre tank", result.Litres)
+		}
+	}
+
+	for _, query := range []string{"tank=big", "level=1/4", "tank=55&level=60", "tank=55&minFill=lots"} {
+		req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&"+query, nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error == "" {
+			t.Errorf("%s: expected an error, got %d results", query, len(response.Results))
+		}
+	}
 }
 
-func TestExportToCSV(t *testing.T) {
-	results := []Result{
-		{Litres: 25.0, CostPounds: "32.23", LitresIsPalindrome: false, Type: "whole"},
-		{Litres: 38.83, CostPounds: "50.05", LitresIsPalindrome: true, Type: "palindromic_decimal"},
+func TestHandleAPI_Vehicle(t *testing.T) {
+	path := useTempGarage(t)
+	garage := &Garage{Vehicles: []Vehicle{{Name: "van", Capacity: 80, TypicalFill: 60}}}
+	if err := garage.Save(path); err != nil {
+		t.Fatal(err)
 	}
 
-	// Test export to temporary file
-	tmpfile, err := os.CreateTemp("", "test_export_*.csv")
-	if err != nil {
-		t.Fatalf("Failed to create temp file: %v", err)
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&vehicle=VAN&level=1/4", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatalf("Expected results, got %+v", response)
+	}
+	for _, result := range response.Results {
+		if result.Litres > 60 || result.TankLevel != 20+result.Litres {
+			t.Errorf("%v litres leaves the van's tank at %v", result.Litres, result.TankLevel)
+		}
 	}
-	defer os.Remove(tmpfile.Name())
-	defer tmpfile.Close()
 
-	err = exportToCSV(tmpfile.Name(), results, 128.9)
-	if err != nil {
-		t.Errorf("exportToCSV failed: %v", err)
+	body := `{"pricePerLitre": 128.9, "maxLitres": 30, "vehicle": "van"}`
+	req = httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	for _, result := range response.Results {
+		if result.Litres > 30 || result.TankFull == 0 {
+			t.Errorf("POST with a vehicle gave %+v", result)
+		}
 	}
 
-	// Read back the file and verify content
-	content, err := os.ReadFile(tmpfile.Name())
-	if err != nil {
-		t.Errorf("Failed to read exported file: %v", err)
+	// A tank the request gives outranks the vehicle's
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.9&vehicle=van&tank=50&level=1/2", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatalf("Expected results, got %+v", response)
+	}
+	for _, result := range response.Results {
+		if result.Litres > 25 || result.TankLevel != 25+result.Litres {
+			t.Errorf("%v litres into a half-full 50 litre tank leaves it at %v", result.Litres, result.TankLevel)
+		}
 	}
 
-	contentStr := string(content)
-	// Check for expected content
-	expectedLines := []string{
-		"Price per Litre (p),Litres,Cost (£),Litres is Palindrome,Type",
-		"128.9,25,32.23,No,whole",
-		"128.9,38.83,50.05,Yes,palindromic_decimal",
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.9&vehicle=van&unit=us-gallons", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	if !strings.Contains(rr.Body.String(), `vehicle \"van\" is measured in litres, not us-gallons`) {
+		t.Errorf("expected a unit conflict error, got %s", rr.Body.String())
 	}
 
-	for _, line := range expectedLines {
-		if !strings.Contains(contentStr, line) {
-			t.Errorf("Expected line %q not found in exported CSV", line)
-		}
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.9&vehicle=bus", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	if !strings.Contains(rr.Body.String(), `no vehicle called \"bus\"`) {
+		t.Errorf("expected a missing vehicle error, got %s", rr.Body.String())
 	}
 }
 
-func TestHandleAPI(t *testing.T) {
-	// Test GET request
-	req, err := http.NewRequest("GET", "/api/calculate?price=128.9&max=50", nil)
-	if err != nil {
+func TestHandleWebUI_Vehicle(t *testing.T) {
+	path := useTempGarage(t)
+	garage := &Garage{Vehicles: []Vehicle{{Name: "van", Capacity: 80, FuelType: "diesel"}}}
+	if err := garage.Save(path); err != nil {
 		t.Fatal(err)
 	}
 
+	req := httptest.NewRequest("POST", "/", strings.NewReader("price=128.9&vehicle=van&level=1/4"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleAPI)
-	handler.ServeHTTP(rr, req)
+	handleWebUI(rr, req)
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	body := rr.Body.String()
+	if !strings.Contains(body, `<option value="van" selected>van (diesel, 80 L)</option>`) {
+		t.Error("expected the van to be selected")
 	}
+	if !strings.Contains(body, "Tank 45.0 L, 56% full") {
+		t.Error("expected results using the van's tank")
+	}
+}
+
+func TestHandleAPI_Budget(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&minSpend=40&maxSpend=60", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
 
 	var response CalculateResponse
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("Failed to unmarshal response: %v", err)
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 {
+		t.Fatalf("Expected results, got %+v", response)
+	}
+	for _, result := range response.Results {
+		if cost, _ := strconv.ParseFloat(result.CostPounds, 64); cost < 40 || cost > 60 {
+			t.Errorf("£%s is outside a £40-£60 budget", result.CostPounds)
+		}
+	}
+
+	for _, query := range []string{"minSpend=lots", "maxSpend=-1", "minSpend=60&maxSpend=40", "minSpend=500", "minSpend=inf", "maxSpend=NaN"} {
+		req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&"+query, nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error == "" {
+			t.Errorf("%s: expected an error, got %d results", query, len(response.Results))
+		}
 	}
 
+	// With both spends bad, the minimum is always the one reported
+	for range 10 {
+		req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&minSpend=a&maxSpend=b", nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error != "Invalid minSpend parameter" {
+			t.Fatalf("expected the minSpend error, got %s", rr.Body.String())
+		}
+	}
+}
+
+func TestHandleAPI_Discount(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&discountPerUnit=5", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 || response.Results[0].PumpPounds != "41.54" || response.Results[0].CostPounds != "39.93" {
+		t.Fatalf("Expected £41.54 at the pump for £39.93, got %+v", response)
+	}
+
+	body := `{"pricePerLitre": 128.9, "maxLitres": 100, "discount": {"fixed": 2, "threshold": 40}}`
+	req = httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
 	if len(response.Results) == 0 {
-		t.Errorf("Expected some results, got 0")
+		t.Fatalf("Expected results, got %+v", response)
+	}
+	for _, result := range response.Results {
+		if result.PumpPounds == "" {
+			t.Errorf("%+v has no pump total", result)
+		}
 	}
 
-	if response.Error != "" {
-		t.Errorf("Unexpected error in response: %s", response.Error)
+	for _, query := range []string{"discountFixed=lots", "discountPercent=100", "discountPerUnit=-5", "discountPercent=NaN", "discountOver=inf"} {
+		req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&"+query, nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error == "" {
+			t.Errorf("%s: expected an error, got %d results", query, len(response.Results))
+		}
 	}
 }
 
-func TestHandleAPI_POST(t *testing.T) {
-	// Test POST request
-	reqBody := CalculateRequest{PricePerLitre: 128.9, MaxLitres: 50}
-	jsonBody, _ := json.Marshal(reqBody)
+func TestHandleAPI_Items(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&item=wash=6.50&item=coffee=3.20", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
 
-	req, err := http.NewRequest("POST", "/api/calculate", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		t.Fatal(err)
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if len(response.Results) == 0 || response.Results[0].CostPounds != "20.02" || response.Results[0].ExtrasPounds != "9.70" {
+		t.Fatalf("Expected £20.02 with £9.70 of extras, got %+v", response)
+	}
+
+	body := `{"pricePerLitre": 128.9, "maxLitres": 100, "items": [{"name": "wash", "price": 6.5}, {"name": "coffee", "price": 3.2}]}`
+	req = httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	post := CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &post); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if !reflect.DeepEqual(post.Results, response.Results) {
+		t.Errorf("POST items found %+v, want %+v", post.Results, response.Results)
+	}
+
+	for _, query := range []string{"item=wash", "item=wash=free", "item=wash=-6.50"} {
+		req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&"+query, nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error == "" {
+			t.Errorf("%s: expected an error, got %d results", query, len(response.Results))
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/api/calculate", strings.NewReader(`{"pricePerLitre": 128.9, "maxLitres": 100, "items": [{"name": "wash"}]}`))
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Error == "" {
+		t.Error("expected an error for an item without a price")
+	}
+}
 
+func TestHandleWebUI_Items(t *testing.T) {
+	form := "price=128.9&max=100&itemName=wash&itemPrice=6.50&itemName=coffee&itemPrice=3.20&itemName=&itemPrice="
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleAPI)
-	handler.ServeHTTP(rr, req)
+	handleWebUI(rr, req)
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	body := rr.Body.String()
+	if !strings.Contains(body, "£10.32 at the pump, £9.70 of extras") {
+		t.Error("expected results with the basket's extras")
+	}
+	if !strings.Contains(body, `value="wash"`) || !strings.Contains(body, `value="3.2"`) {
+		t.Error("expected the form to keep the basket")
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("price=128.9&max=100&itemName=wash&itemPrice="))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handleWebUI(rr, req)
+	if !strings.Contains(rr.Body.String(), "Invalid input values") {
+		t.Error("expected an error for an item without a price")
 	}
+}
+
+func TestHandleAPI_VAT(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=2&vat=20&palindrome=digits", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
 
 	var response CalculateResponse
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("Failed to unmarshal response: %v", err)
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 || response.Results[0].VATPounds == "" {
+		t.Fatalf("Expected results with VAT lines, got %+v", response)
 	}
 
-	if len(response.Results) == 0 {
-		t.Errorf("Expected some results, got 0")
+	body := `{"pricePerLitre": 128.9, "maxLitres": 100, "vat": {"rate": 20, "rounding": "down"}}`
+	req = httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	found := false
+	for _, result := range response.Results {
+		if result.CostPounds == "54.45" {
+			found = result.VATPounds == "9.07"
+		}
+	}
+	if !found {
+		t.Errorf("Expected £54.45 with £9.07 VAT rounded down, got %+v", response)
+	}
+
+	for _, query := range []string{"vat=lots", "vat=120", "vat=20&vatRounding=sideways"} {
+		req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&"+query, nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error == "" {
+			t.Errorf("%s: expected an error, got %d results", query, len(response.Results))
+		}
 	}
 }
 
-func TestHandleAPI_InvalidInput(t *testing.T) {
-	// Test invalid GET request
-	req, err := http.NewRequest("GET", "/api/calculate?price=invalid&max=50", nil)
-	if err != nil {
-		t.Fatal(err)
+func TestHandleWebUI_VAT(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("price=128.9&max=2&palindrome=digits&vat=20&vatRounding=down"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handleWebUI(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "net £1.51, VAT £0.30") {
+		t.Error("expected the VAT lines")
+	}
+	if !strings.Contains(body, "Palindromic net") || !strings.Contains(body, "Palindromic VAT") {
+		t.Error("expected badges for the palindromic net and VAT")
 	}
+	if !strings.Contains(body, `<option value="down" selected>`) {
+		t.Error("expected the form to keep the VAT rounding")
+	}
+}
 
+func TestHandleAPI_EV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=79&max=100&mode=ev&sessionFee=0.35", nil)
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleAPI)
-	handler.ServeHTTP(rr, req)
+	handleAPI(rr, req)
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 || response.Results[0].Unit != "kwh" || response.Results[0].CostPounds != "77.77" {
+		t.Fatalf("Expected 98 kWh for £77.77, got %+v", response)
+	}
+
+	body := `{"pricePerLitre": 79, "maxLitres": 40, "mode": "ev", "match": "volume", "fees": {"idle": 2}}`
+	req = httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 || response.Results[0].Volume != "1.00" || response.Results[0].CostPounds != "2.79" {
+		t.Fatalf("Expected 1 kWh for £2.79 first, got %+v", response)
+	}
+
+	for _, query := range []string{"mode=hybrid", "mode=ev&unit=litres", "mode=ev&sessionFee=-1", "mode=ev&idleFee=lots", "sessionFee=1", "match=sideways"} {
+		req = httptest.NewRequest("GET", "/api/calculate?price=79&max=100&"+query, nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error == "" {
+			t.Errorf("%s: expected an error, got %d results", query, len(response.Results))
+		}
+	}
+
+	// With both fees bad, the session fee is always the one reported
+	for range 10 {
+		req = httptest.NewRequest("GET", "/api/calculate?price=79&max=100&mode=ev&sessionFee=a&idleFee=b", nil)
+		rr = httptest.NewRecorder()
+		handleAPI(rr, req)
+		response = CalculateResponse{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response.Error != "invalid sessionFee parameter" {
+			t.Fatalf("expected the sessionFee error, got %s", rr.Body.String())
+		}
+	}
+}
+
+func TestHandleWebUI_EV(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("price=79&max=100&mode=ev&unit=litres&sessionFee=0.35"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handleWebUI(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "£77.42 at the charger, £0.35 of fees") {
+		t.Error("expected results with the session fee")
+	}
+	if !strings.Contains(body, "Stop window 12.7 Wh") {
+		t.Error("expected the stop window in Wh")
+	}
+	if !strings.Contains(body, `<option value="ev" selected>`) || !strings.Contains(body, `value="0.35"`) {
+		t.Error("expected the form to stay in EV mode")
 	}
+}
+
+func TestHandleWebUI_BestPick(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("price=128.9&max=100"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handleWebUI(rr, req)
+
+	body := rr.Body.String()
+	if n := strings.Count(body, `result-card best-pick`); n != 1 {
+		t.Fatalf("expected one best pick, got %d", n)
+	}
+	// The first double palindrome wins
+	pick := body[strings.Index(body, `result-card best-pick`):]
+	if !strings.Contains(pick[:strings.Index(pick, "</div>")], "38.83 L = £50.05") {
+		t.Errorf("best pick isn't 38.83 L = £50.05")
+	}
+}
+
+func TestHandleAPI_ExactPrice(t *testing.T) {
+	body := `{"pricePerLitre": 128.950, "maxLitres": 100}`
+	req := httptest.NewRequest("POST", "/api/calculate", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	if !strings.Contains(rr.Body.String(), `"Price":128.950`) {
+		t.Errorf("Expected the price digits to round-trip, got %s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.95&max=100", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
 
 	var response CalculateResponse
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("Failed to unmarshal response: %v", err)
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	for _, result := range response.Results {
+		if result.Price != "128.95" {
+			t.Errorf("result price = %q, want 128.95", result.Price)
+		}
+	}
+}
+
+func TestHandleAPI_Stream(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=128.9&max=1000&stream=true", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	want := FindPalindromicFuelCosts(128.9, 1000, 0)
+	if len(lines) != len(want) {
+		t.Fatalf("streamed %d lines, want %d", len(lines), len(want))
+	}
+	var first Result
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Failed to unmarshal first line: %v", err)
+	}
+	if first.CostPounds != want[0].CostPounds {
+		t.Errorf("first streamed cost = %s, want %s", first.CostPounds, want[0].CostPounds)
+	}
+
+	req = httptest.NewRequest("GET", "/api/calculate?price=128.9&max=100&stream=maybe", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	if !strings.Contains(rr.Body.String(), "Invalid stream parameter") {
+		t.Errorf("Expected error for invalid stream parameter, got %s", rr.Body.String())
+	}
+}
+
+func TestHandleAPI_Currency(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=150&max=100&currency=EUR", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 || response.Results[0].CostPounds != "30,03" {
+		t.Errorf("Expected 30,03 € first, got %+v", response)
 	}
 
+	req = httptest.NewRequest("GET", "/api/calculate?price=150&max=100&currency=XXX", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
 	if response.Error == "" {
-		t.Errorf("Expected error in response for invalid input")
+		t.Errorf("Expected error for unknown currency")
+	}
+}
+
+func TestHandleAPI_Unit(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/calculate?price=599.9&max=20&unit=imperial-gallons", nil)
+	rr := httptest.NewRecorder()
+	handleAPI(rr, req)
+
+	var response CalculateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) == 0 || response.Results[0].Unit != "imperial-gallons" {
+		t.Fatalf("Expected imperial gallon results, got %+v", response)
+	}
+	if response.Results[0].Volume != "10.01" || response.Results[0].CostPounds != "60.06" {
+		t.Errorf("Expected 10.01 gallons = £60.06 first, got %+v", response.Results[0])
+	}
+
+	req = httptest.NewRequest("GET", "/api/calculate?price=599.9&max=20&unit=barrels", nil)
+	rr = httptest.NewRecorder()
+	handleAPI(rr, req)
+	response = CalculateResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Error == "" {
+		t.Errorf("Expected error for unknown unit")
 	}
 }
 
 func TestExportBatchToCSV(t *testing.T) {
-	batchResults := map[float64][]Result{
-		128.9: {
+	batchResults := map[Price][]Result{
+		"128.9": {
 			{Litres: 25.0, CostPounds: "32.23", LitresIsPalindrome: false, Type: "whole"},
 		},
-		135.7: {
+		"135.7": {
 			{Litres: 20.0, CostPounds: "27.14", LitresIsPalindrome: false, Type: "whole"},
 		},
 	}
-	prices := []float64{128.9, 135.7}
+	prices := []Price{"128.9", "135.7"}
 
 	// Test export to temporary file
 	tmpfile, err := os.CreateTemp("", "test_batch_export_*.csv")
@@ -550,7 +3448,7 @@ func TestExportBatchToCSV(t *testing.T) {
 	defer os.Remove(tmpfile.Name())
 	defer tmpfile.Close()
 
-	err = exportBatchToCSV(tmpfile.Name(), batchResults, prices)
+	err = exportBatchToCSV(tmpfile.Name(), batchResults, prices, GBP, Litres)
 	if err != nil {
 		t.Errorf("exportBatchToCSV failed: %v", err)
 	}
@@ -576,6 +3474,35 @@ func TestExportBatchToCSV(t *testing.T) {
 	}
 }
 
+func TestExportToCSVExactPrice(t *testing.T) {
+	results := FindPalindromicFuelCostsAt("128.95", 100, 0)
+	if len(results) == 0 {
+		t.Fatalf("expected results at 128.95p")
+	}
+
+	tmpfile, err := os.CreateTemp("", "test_export_exact_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	if err := exportToCSV(tmpfile.Name(), slices.Values(results), "128.95", GBP, Litres); err != nil {
+		t.Fatalf("exportToCSV failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	for _, line := range lines[1:] {
+		if !strings.HasPrefix(line, "128.95,") {
+			t.Errorf("row %q lost the price digits", line)
+		}
+	}
+}
+
 func TestExportToCSVEdgeCases(t *testing.T) {
 	// Test empty results
 	emptyResults := []Result{}
@@ -586,7 +3513,7 @@ func TestExportToCSVEdgeCases(t *testing.T) {
 	defer os.Remove(tmpfile.Name())
 	defer tmpfile.Close()
 
-	err = exportToCSV(tmpfile.Name(), emptyResults, 128.9)
+	err = exportToCSV(tmpfile.Name(), slices.Values(emptyResults), "128.9", GBP, Litres)
 	if err != nil {
 		t.Errorf("exportToCSV with empty results failed: %v", err)
 	}
@@ -616,10 +3543,43 @@ func TestExportToCSVEdgeCases(t *testing.T) {
 	defer os.Remove(tmpfile2.Name())
 	defer tmpfile2.Close()
 
-	err = exportToCSV(tmpfile2.Name(), diverseResults, 128.9)
+	err = exportToCSV(tmpfile2.Name(), slices.Values(diverseResults), "128.9", GBP, Litres)
 	if err != nil {
 		t.Errorf("exportToCSV with diverse results failed: %v", err)
 	}
+
+	// Discounted results add the pump total
+	discounted := []Result{{Litres: 32.23, CostPounds: "39.93", Type: "palindromic_decimal", PumpPounds: "41.54", DiscountPounds: "1.61"}}
+	tmpfile3, err := os.CreateTemp("", "test_discount_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpfile3.Name())
+	defer tmpfile3.Close()
+
+	if err := exportToCSV(tmpfile3.Name(), slices.Values(discounted), "128.9", GBP, Litres); err != nil {
+		t.Errorf("exportToCSV with a discount failed: %v", err)
+	}
+	content, _ = os.ReadFile(tmpfile3.Name())
+	if !strings.Contains(string(content), "Pump Total (£),Discount (£),Extras (£),Fees (£),Pump Total Matches") || !strings.Contains(string(content), "41.54,1.61,,,No") {
+		t.Errorf("CSV missing the pump total:\n%s", content)
+	}
+
+	withVAT := []Result{{Litres: 25, CostPounds: "32.23", Type: "whole", NetPounds: "26.86", VATPounds: "5.37"}}
+	tmpfile4, err := os.CreateTemp("", "test_vat_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpfile4.Name())
+	defer tmpfile4.Close()
+
+	if err := exportToCSV(tmpfile4.Name(), slices.Values(withVAT), "128.9", GBP, Litres); err != nil {
+		t.Errorf("exportToCSV with VAT failed: %v", err)
+	}
+	content, _ = os.ReadFile(tmpfile4.Name())
+	if !strings.Contains(string(content), "Net (£),VAT (£),Net Matches,VAT Matches") || !strings.Contains(string(content), "26.86,5.37,No,No") {
+		t.Errorf("CSV missing the VAT lines:\n%s", content)
+	}
 }
 
 func TestParseFloat(t *testing.T) {
@@ -653,11 +3613,59 @@ func BenchmarkFindPalindromicFuelCosts(b *testing.B) {
 }
 
 func BenchmarkGeneratePalindromesForDigits(b *testing.B) {
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		generatePalindromesForDigits(5)
 	}
 }
 
+// generatePalindromesForDigitsStrconv is the string-mirroring generator the
+// arithmetic one replaced, kept as a baseline for the benchmarks
+func generatePalindromesForDigitsStrconv(digits int) []int {
+	var palindromes []int
+	halfDigits := (digits + 1) / 2
+	for i := int(pow10(halfDigits - 1)); i < int(pow10(halfDigits)); i++ {
+		half := strconv.Itoa(i)
+		mirror := reverse(half)
+		if digits%2 == 1 {
+			mirror = mirror[1:]
+		}
+		p, _ := strconv.Atoi(half + mirror)
+		palindromes = append(palindromes, p)
+	}
+	return palindromes
+}
+
+func BenchmarkGeneratePalindromesForDigitsStrconv(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		generatePalindromesForDigitsStrconv(5)
+	}
+}
+
+func BenchmarkPalindromeGenerator(b *testing.B) {
+	b.ReportAllocs()
+	var g PalindromeGenerator
+	for i := 0; i < b.N; i++ {
+		// Every 5-digit palindrome, as above
+		g.Seek(10000)
+		for p, ok := g.Next(); ok && p < 100000; p, ok = g.Next() {
+		}
+	}
+}
+
+func BenchmarkPalindromeGeneratorSeek(b *testing.B) {
+	b.ReportAllocs()
+	var g PalindromeGenerator
+	for i := 0; i < b.N; i++ {
+		// The ten palindromes above a large bound, without generating the rest
+		g.Seek(123456789012)
+		for j := 0; j < 10; j++ {
+			g.Next()
+		}
+	}
+}
+
 func BenchmarkIsPalindrome(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		isPalindrome(12321)